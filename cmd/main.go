@@ -4,12 +4,18 @@ import (
 	"net/http"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/alecthomas/kingpin/v2"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/pstrobl96/prusa_exporter/config"
+	"github.com/pstrobl96/prusa_exporter/control"
+	"github.com/pstrobl96/prusa_exporter/discovery"
+	"github.com/pstrobl96/prusa_exporter/history"
 	prusalink "github.com/pstrobl96/prusa_exporter/prusalink/buddy"
+	einsy "github.com/pstrobl96/prusa_exporter/prusalink/einsy"
+	sl "github.com/pstrobl96/prusa_exporter/prusalink/sl"
 	udp "github.com/pstrobl96/prusa_exporter/udp"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -17,13 +23,18 @@ import (
 
 var (
 	configFile             = kingpin.Flag("config.file", "Configuration file for prusa_exporter.").Default("./prusa.yml").ExistingFile()
+	configWatchInterval    = kingpin.Flag("config.watch-interval", "How often to check the configuration file for changes. 0 disables watching, SIGHUP and /-/reload still work.").Default("30s").Duration()
 	metricsPath            = kingpin.Flag("exporter.metrics-path", "Path where to expose Prusa Link metrics.").Default("/metrics/prusalink").String()
+	probePath              = kingpin.Flag("exporter.probe-path", "Path where to expose metrics of a single printer given by target parameter.").Default("/probe").String()
 	udpMetricsPath         = kingpin.Flag("exporter.udp-metrics-path", "Path where to expose udp metrics.").Default("/metrics/udp").String()
 	metricsPort            = kingpin.Flag("exporter.metrics-port", "Port where to expose metrics.").Default("10009").Int()
 	prusaLinkScrapeTimeout = kingpin.Flag("prusalink.scrape-timeout", "Timeout in seconds to scrape prusalink metrics.").Default("10").Int()
 	logLevel               = kingpin.Flag("log.level", "Log level for zerolog.").Default("info").String()
 	syslogListenAddress    = kingpin.Flag("listen-address", "Address where to expose port for gathering metrics. - format <address>:<port>").Default("0.0.0.0:8514").String()
 	udpPrefix              = kingpin.Flag("prefix", "Prefix for udp metrics").Default("prusa_").String()
+	udpDeviceTimestamps    = kingpin.Flag("udp.device-timestamps", "Expose udp samples with the time they were taken by the printer instead of the scrape time.").Default("false").Bool()
+	udpSeriesTTL           = kingpin.Flag("udp.series-ttl", "Remove udp series of printers that did not push metrics for this long. 0 keeps them forever.").Default("0s").Duration()
+	udpMetricCatalog       = kingpin.Flag("udp.metric-catalog", "Rename udp metrics according to the built-in catalog. Rules in udp.catalog of configuration are applied regardless.").Default("false").Bool()
 	udpRegistry            = prometheus.NewRegistry()
 )
 
@@ -44,6 +55,10 @@ func Run() {
 
 	config, err := config.LoadConfig(*configFile, *prusaLinkScrapeTimeout)
 
+	if err == nil {
+		err = config.Validate()
+	}
+
 	if err != nil {
 		log.Panic().Msg("Error loading configuration file " + err.Error())
 	}
@@ -58,13 +73,66 @@ func Run() {
 	var collectors []prometheus.Collector
 
 	log.Info().Msg("PrusaLink metrics enabled!")
-	collectors = append(collectors, prusalink.NewCollector(config))
+	prusaLinkCollector := prusalink.NewCollector(config)
+	einsyCollector := einsy.NewCollector(config)
+	slCollector := sl.NewCollector(config)
+	collectors = append(collectors, prusaLinkCollector, einsyCollector, slCollector, configReloadSuccess, configReloadSeconds)
+
+	controlHandler, err := control.NewHandler(config)
+	if err != nil {
+		log.Panic().Msg("Error opening audit log " + err.Error())
+	}
+	http.Handle("POST /api/printers/{name}/job/{action}", controlHandler)
+
+	if config.History.Path != "" {
+		historyStore, err := history.Open(config.History)
+		if err != nil {
+			log.Panic().Msg("Error opening job history " + err.Error())
+		}
+		prusalink.OnJobEnd(historyStore.Record)
+		go historyStore.PruneEvery(time.Hour)
+		http.Handle("GET /api/history", historyStore)
+		log.Info().Msg("Job history stored in " + config.History.Path)
+	}
+
+	discoverer := discovery.NewDiscoverer(config, prusaLinkCollector.Reload, einsyCollector.Reload, slCollector.Reload, udp.SetSources, udp.SetPrinters)
+	collectors = append(collectors, discoverer)
+	go discoverer.Run()
+
+	reloader := newReloader(*configFile, *prusaLinkScrapeTimeout, config, checkUDP, discoverer.Reload, controlHandler.Reload, reloadUDP)
+	go reloader.watch(*configWatchInterval)
+	http.Handle("/-/reload", reloader)
+	http.HandleFunc(*probePath, prusaLinkCollector.ServeProbe)
+	http.HandleFunc("GET /printers/{name}/thumbnail.png", prusaLinkCollector.ServeThumbnail)
+	http.HandleFunc("GET /printers/{name}/cameras/{camera}/snapshot", prusaLinkCollector.ServeCameraSnapshot)
 
 	// starting syslog server
 
-	log.Info().Msg("Syslog server starting at: " + *syslogListenAddress)
-	go udp.MetricsListener(*syslogListenAddress, *udpPrefix)
-	log.Info().Msg("Syslog server ready to receive metrics")
+	udp.Init(udpRegistry, *udpDeviceTimestamps)
+
+	if err := udp.SetCatalog(config.UDP.Catalog, *udpMetricCatalog); err != nil {
+		log.Panic().Msg("Error loading udp metric catalog: " + err.Error())
+	}
+
+	if err := udp.SetFilter(config.UDP.Filter, config.UDP.Limits); err != nil {
+		log.Panic().Msg("Error loading udp filter: " + err.Error())
+	}
+
+	udp.SetSources(config)
+	udp.SetPrinters(config)
+
+	if config.UDP.InfluxDB.URL != "" {
+		log.Info().Msg("Writing udp metrics to InfluxDB at " + config.UDP.InfluxDB.URL)
+		udp.StartInfluxDB(config.UDP.InfluxDB)
+	}
+
+	if config.UDP.RemoteWrite.URL != "" {
+		log.Info().Msg("Sending udp metrics to remote_write endpoint " + config.UDP.RemoteWrite.URL)
+		udp.StartRemoteWrite(config.UDP.RemoteWrite)
+	}
+
+	log.Info().Msg("Syslog server starting")
+	go udp.MetricsListener(config.UDP.Listeners, *syslogListenAddress, *udpPrefix)
 
 	// registering the prometheus metrics
 
@@ -73,7 +141,10 @@ func Run() {
 	http.Handle(*metricsPath, promhttp.Handler())
 	log.Info().Msg("PrusaLink metrics initialized")
 
-	udp.Init(udpRegistry)
+	if *udpSeriesTTL > 0 {
+		log.Info().Msg("UDP series expire after " + udpSeriesTTL.String())
+		go udp.ExpireSeries(*udpSeriesTTL)
+	}
 
 	http.Handle(*udpMetricsPath, promhttp.HandlerFor(udpRegistry, promhttp.HandlerOpts{
 		Registry: udpRegistry,
@@ -89,6 +160,7 @@ func Run() {
     <h1>prusa_exporter</h1>
 	<p>Syslog server running at - <b>` + *syslogListenAddress + `</b></p>
     <p><a href="` + *metricsPath + `">PrusaLink metrics</a></p>
+	<p>Probe a printer - <b>` + *probePath + `?target=&lt;address&gt;&amp;module=&lt;name&gt;</b></p>
 	<p><a href="` + *udpMetricsPath + `">UDP Metrics</a></p>
 	</body>
     </html>`))
@@ -97,3 +169,18 @@ func Run() {
 	log.Fatal().Msg(http.ListenAndServe(":"+strconv.Itoa(*metricsPort), nil).Error())
 
 }
+
+// checkUDP returns error if the udp catalog or filter of the reloaded configuration can't be applied
+func checkUDP(cfg config.Config) error {
+	return udp.CheckConfig(cfg, *udpMetricCatalog)
+}
+
+// reloadUDP applies the udp catalog and filter of the reloaded configuration, they are checked by checkUDP
+func reloadUDP(cfg config.Config) {
+	if err := udp.SetCatalog(cfg.UDP.Catalog, *udpMetricCatalog); err != nil {
+		log.Error().Msg("Error reloading udp metric catalog: " + err.Error())
+	}
+	if err := udp.SetFilter(cfg.UDP.Filter, cfg.UDP.Limits); err != nil {
+		log.Error().Msg("Error reloading udp filter: " + err.Error())
+	}
+}
@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/pstrobl96/prusa_exporter/config"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	configReloadSuccess = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "prusa_exporter_config_last_reload_successful",
+			Help: "Whether the last configuration reload attempt was successful.",
+		},
+	)
+	configReloadSeconds = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "prusa_exporter_config_last_reload_success_timestamp_seconds",
+			Help: "Timestamp of the last successful configuration reload.",
+		},
+	)
+
+	// staticSections are applied only when the exporter starts, reload which changes them is rejected
+	staticSections = []struct {
+		name    string
+		section func(config.Config) any
+	}{
+		{"udp.influxdb", func(c config.Config) any { return c.UDP.InfluxDB }},
+		{"udp.remote_write", func(c config.Config) any { return c.UDP.RemoteWrite }},
+		{"udp.listeners", func(c config.Config) any { return c.UDP.Listeners }},
+		{"history", func(c config.Config) any { return c.History }},
+		{"control.audit_log", func(c config.Config) any { return c.Control.AuditLog }},
+	}
+)
+
+// reloader reloads the configuration file and hands the new configuration to its consumers
+type reloader struct {
+	mu       sync.Mutex
+	path     string
+	timeout  int
+	contents []byte
+	rejected []byte
+	started  config.Config // configuration the exporter started with
+	check    func(config.Config) error
+	apply    []func(config.Config)
+}
+
+// newReloader returns reloader of the configuration file. Configuration is handed to apply
+// only if check accepts it, so no consumer can fail to apply it.
+func newReloader(path string, scrapeTimeout int, started config.Config, check func(config.Config) error, apply ...func(config.Config)) *reloader {
+	r := &reloader{
+		path:    path,
+		timeout: scrapeTimeout,
+		started: started,
+		check:   check,
+		apply:   apply,
+	}
+	r.contents, _ = os.ReadFile(path)
+	configReloadSuccess.Set(1)
+	configReloadSeconds.SetToCurrentTime()
+	return r
+}
+
+// reload loads and validates the configuration file. Consumers are updated only if the new file is valid.
+// Unless forced, nothing happens when the file did not change since the last successful reload.
+func (r *reloader) reload(force bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	contents, err := os.ReadFile(r.path)
+	if err != nil {
+		configReloadSuccess.Set(0)
+		return err
+	}
+
+	if !force && (bytes.Equal(contents, r.contents) || bytes.Equal(contents, r.rejected)) {
+		return nil
+	}
+
+	cfg, err := config.ParseConfig(contents, r.timeout)
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err == nil {
+		err = r.check(cfg)
+	}
+	if err == nil {
+		err = r.checkStatic(cfg)
+	}
+	if err != nil {
+		r.rejected = contents
+		configReloadSuccess.Set(0)
+		return err
+	}
+
+	for _, apply := range r.apply {
+		apply(cfg)
+	}
+	r.contents = contents
+	r.rejected = nil
+
+	configReloadSuccess.Set(1)
+	configReloadSeconds.SetToCurrentTime()
+	log.Info().Msgf("Configuration reloaded from %s - %d printers configured", r.path, len(cfg.Printers))
+	return nil
+}
+
+// checkStatic returns error if the configuration changes sections that need restart of the exporter
+func (r *reloader) checkStatic(cfg config.Config) error {
+	var changed []string
+	for _, s := range staticSections {
+		if !reflect.DeepEqual(s.section(r.started), s.section(cfg)) {
+			changed = append(changed, s.name)
+		}
+	}
+	if len(changed) > 0 {
+		return fmt.Errorf("%s can't be changed by reload, restart the exporter", strings.Join(changed, ", "))
+	}
+	return nil
+}
+
+// watch reloads the configuration on SIGHUP and whenever the file changes on disk
+func (r *reloader) watch(interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-hup:
+			log.Info().Msg("SIGHUP received, reloading configuration")
+			if err := r.reload(true); err != nil {
+				log.Error().Msg("Error reloading configuration file " + err.Error())
+			}
+		case <-tick:
+			if err := r.reload(false); err != nil {
+				log.Error().Msg("Error reloading configuration file " + err.Error())
+			}
+		}
+	}
+}
+
+// ServeHTTP handles POST /-/reload
+func (r *reloader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Only POST requests allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := r.reload(true); err != nil {
+		log.Error().Msg("Error reloading configuration file " + err.Error())
+		http.Error(w, "failed to reload config: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
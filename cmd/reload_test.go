@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/pstrobl96/prusa_exporter/config"
+)
+
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prusa.yml")
+	write := func(contents string) {
+		if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	const started = "printers:\n  - address: 10.0.0.5\nudp:\n  influxdb:\n    url: http://influx:8086\n"
+	write(started)
+	startedCfg, err := config.LoadConfig(path, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var applied []config.Config
+	r := newReloader(path, 1, startedCfg, checkUDP, func(cfg config.Config) { applied = append(applied, cfg) })
+
+	// unchanged file is not applied unless forced
+	if err := r.reload(false); err != nil || len(applied) != 0 {
+		t.Fatalf("unchanged file: got %v and %d applied configurations", err, len(applied))
+	}
+
+	write(started + "  filter:\n    deny_measurements: [\"loadcell.*\"]\n")
+	if err := r.reload(false); err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 1 || len(applied[0].UDP.Filter.DenyMeasurements) != 1 {
+		t.Fatalf("filter change: got %+v", applied)
+	}
+
+	type testCase struct {
+		Name     string
+		Contents string
+		Error    string
+	}
+	cases := []testCase{
+		{"invalid", "printers:\n  - name: no address\n", "has no address"},
+		// valid expression that can't be anchored by the udp filter
+		{"udp filter", started + "  filter:\n    deny_measurements: [\"\\\\Qloadcell\"]\n", "missing closing )"},
+		{"influxdb", "printers:\n  - address: 10.0.0.5\nudp:\n  influxdb:\n    url: http://other:8086\n", "udp.influxdb can't be changed by reload"},
+		{"sinks and history", started + "  remote_write:\n    url: http://prometheus:9090/api/v1/write\nhistory:\n  path: /tmp/history.db\n",
+			"udp.remote_write, history can't be changed by reload"},
+	}
+	for _, tc := range cases {
+		write(tc.Contents)
+		err := r.reload(false)
+		if err == nil || !strings.Contains(err.Error(), tc.Error) {
+			t.Errorf("%s: got error %v, want %q", tc.Name, err, tc.Error)
+		}
+		if len(applied) != 1 {
+			t.Errorf("%s: rejected configuration was applied", tc.Name)
+		}
+		if value := testutil.ToFloat64(configReloadSuccess); value != 0 {
+			t.Errorf("%s: last reload successful = %v, want 0", tc.Name, value)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/-/reload", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: got %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+
+	write(started)
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("POST", "/-/reload", nil))
+	if rec.Code != http.StatusOK || len(applied) != 2 {
+		t.Errorf("POST: got %d and %d applied configurations, want 200 and 2", rec.Code, len(applied))
+	}
+	if value := testutil.ToFloat64(configReloadSuccess); value != 1 {
+		t.Errorf("last reload successful = %v, want 1", value)
+	}
+}
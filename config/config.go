@@ -1,7 +1,12 @@
 package config
 
 import (
+	"fmt"
+	"net"
 	"os"
+	"regexp"
+	"slices"
+	"strings"
 
 	"github.com/rs/zerolog"
 	"gopkg.in/yaml.v3"
@@ -18,7 +23,139 @@ type Config struct {
 	PrusaLink struct {
 		CommonLabels   []string `yaml:"common_labels"`
 		DisableMetrics []string `yaml:"disable_metrics"`
+		PollInterval   int      `yaml:"poll_interval"`  // seconds between polls of each printer
+		FilesInterval  int      `yaml:"files_interval"` // seconds between listings of files of each printer
 	} `yaml:"prusalink"`
+	Modules map[string]Module `yaml:"modules"`
+	UDP     struct {
+		InfluxDB    InfluxDB              `yaml:"influxdb"`
+		RemoteWrite RemoteWrite           `yaml:"remote_write"`
+		Catalog     map[string]MetricRule `yaml:"catalog"`
+		Filter      UDPFilter             `yaml:"filter"`
+		Limits      UDPLimits             `yaml:"limits"`
+		Sources     UDPSources            `yaml:"sources"`
+		Listeners   []Listener            `yaml:"listeners"`
+	} `yaml:"udp"`
+	Discovery Discovery `yaml:"discovery"`
+	Control   struct {
+		Tokens   []ControlToken   `yaml:"tokens"`
+		Printers []ControlPrinter `yaml:"printers"`
+		AuditLog string           `yaml:"audit_log"`
+	} `yaml:"control"`
+	History History `yaml:"history"`
+}
+
+// MetricRule describes how a metric sent by the printer over UDP is exported.
+// It is looked up by the name the printer uses, e.g. temp_noz or xbe_fan_rpm.
+type MetricRule struct {
+	Name         string            `yaml:"name"`
+	Help         string            `yaml:"help"`
+	Scale        float64           `yaml:"scale"`         // value is multiplied by scale, e.g. 0.001 for millimeters to meters
+	Labels       map[string]string `yaml:"labels"`        // constant labels added to every series
+	RenameLabels map[string]string `yaml:"rename_labels"` // tags of the printer renamed to labels
+	FieldLabel   string            `yaml:"field_label"`   // fields of the measurement are folded into this label
+}
+
+// Discovery struct containing the configuration of printer discovery
+type Discovery struct {
+	Interval int `yaml:"interval"` // seconds between discovery runs
+	MDNS     struct {
+		Enabled  bool     `yaml:"enabled"`
+		Services []string `yaml:"services"`
+		Domain   string   `yaml:"domain"`
+		Timeout  int      `yaml:"timeout"` // seconds to wait for mDNS responses
+	} `yaml:"mdns"`
+	Subnets  []string `yaml:"subnets"`
+	AutoAdd  bool     `yaml:"auto_add"` // scrape discovered printers as if they were configured
+	Template Module   `yaml:"template"` // credentials used for discovered printers
+}
+
+// Enabled returns true if any discovery method is configured
+func (d Discovery) Enabled() bool {
+	return d.MDNS.Enabled || len(d.Subnets) > 0
+}
+
+// History struct containing the configuration of the print job history
+type History struct {
+	Path          string `yaml:"path"`           // file of the database, history is disabled when empty
+	RetentionDays int    `yaml:"retention_days"` // jobs that ended earlier are removed, 0 keeps them forever
+	MaxJobs       int    `yaml:"max_jobs"`       // oldest jobs above this count are removed, 0 means no limit
+}
+
+// ControlToken struct containing a bearer token allowed to control printers
+type ControlToken struct {
+	Name  string `yaml:"name"`
+	Token string `yaml:"token"`
+}
+
+// ControlPrinter struct containing actions allowed for the printer with the given name
+type ControlPrinter struct {
+	Name    string   `yaml:"name"`
+	Actions []string `yaml:"actions"`
+}
+
+// RemoteWrite struct containing the configuration of Prometheus remote_write output for udp metrics
+type RemoteWrite struct {
+	URL           string `yaml:"url"`
+	Username      string `yaml:"username,omitempty"`
+	Password      string `yaml:"password,omitempty"`
+	BearerToken   string `yaml:"bearer_token,omitempty"`
+	BatchSize     int    `yaml:"batch_size"`
+	FlushInterval int    `yaml:"flush_interval"` // seconds
+	MaxRetries    int    `yaml:"max_retries"`
+	QueueSize     int    `yaml:"queue_size"`
+}
+
+// InfluxDB struct containing the configuration of InfluxDB v2 output for udp metrics
+type InfluxDB struct {
+	URL           string `yaml:"url"`
+	Org           string `yaml:"org"`
+	Bucket        string `yaml:"bucket"`
+	Token         string `yaml:"token"`
+	BatchSize     int    `yaml:"batch_size"`
+	FlushInterval int    `yaml:"flush_interval"` // seconds
+	MaxRetries    int    `yaml:"max_retries"`
+	QueueSize     int    `yaml:"queue_size"`
+}
+
+// UDPFilter struct containing regular expressions of udp metrics that are accepted. Expressions are anchored
+// and matched against names sent by the printer. Empty allow list accepts everything that is not denied.
+type UDPFilter struct {
+	AllowMeasurements []string `yaml:"allow_measurements"`
+	DenyMeasurements  []string `yaml:"deny_measurements"`
+	AllowFields       []string `yaml:"allow_fields"`
+	DenyFields        []string `yaml:"deny_fields"`
+	AllowTags         []string `yaml:"allow_tags"` // tags that are not allowed are dropped from the sample
+	DenyTags          []string `yaml:"deny_tags"`
+}
+
+// Patterns returns all expressions of the filter
+func (f UDPFilter) Patterns() []string {
+	return slices.Concat(f.AllowMeasurements, f.DenyMeasurements, f.AllowFields, f.DenyFields, f.AllowTags, f.DenyTags)
+}
+
+// UDPLimits struct containing limits of udp metrics exported per printer, 0 means no limit
+type UDPLimits struct {
+	MaxFamilies      int `yaml:"max_families_per_printer"`
+	MaxSeries        int `yaml:"max_series_per_printer"`
+	MaxFamiliesTotal int `yaml:"max_families"` // limits of all printers together
+	MaxSeriesTotal   int `yaml:"max_series"`
+}
+
+// UDPSources struct containing which senders are allowed to push udp metrics, everything is accepted when empty
+type UDPSources struct {
+	AllowedCIDRs      []string `yaml:"allowed_cidrs"`
+	KnownPrintersOnly bool     `yaml:"known_printers_only"` // accept only addresses of configured printers, each bound to the first mac it sends
+}
+
+// Listener struct containing the configuration of a syslog or line protocol listener receiving udp metrics
+type Listener struct {
+	Address     string `yaml:"address"`
+	Protocol    string `yaml:"protocol"` // udp, tcp or tls - udp when empty
+	Format      string `yaml:"format"`   // rfc5424, rfc3164, automatic or line - rfc5424 when empty
+	CertFile    string `yaml:"cert_file"`
+	KeyFile     string `yaml:"key_file"`
+	IdentityTag string `yaml:"identity_tag"` // tag of line protocol with mac or name of configured printer, source address identifies other senders
 }
 
 // Printers struct containing the printer configuration
@@ -29,24 +166,213 @@ type Printers struct {
 	Apikey    string `yaml:"apikey,omitempty"`
 	Name      string `yaml:"name,omitempty"`
 	Type      string `yaml:"type,omitempty"`
+	Board     string `yaml:"board,omitempty"` // buddy, einsy or sl - derived from type when empty
+	Mac       string `yaml:"mac,omitempty"`   // mac sent in udp metrics, matched by address of the printer when empty
 	Reachable bool
+	Probe     bool `yaml:"-"` // printer queried by /probe or discovery, exporter metrics are not recorded for it
+}
+
+// printerBoards maps printer types to their boards, every board has its own collector
+var printerBoards = map[string]string{
+	"MINI":    "buddy",
+	"MK35":    "buddy",
+	"MK39":    "buddy",
+	"MK4":     "buddy",
+	"XL":      "buddy",
+	"IX":      "buddy",
+	"I3MK3S":  "einsy",
+	"I3MK3":   "einsy",
+	"I3MK25S": "einsy",
+	"I3MK25":  "einsy",
+	"SL1":     "sl",
+	"SL1S":    "sl",
+}
+
+// GetBoard returns board of the printer - buddy, einsy or sl. Printers of unknown type are buddy.
+func (p Printers) GetBoard() string {
+	if p.Board != "" {
+		return strings.ToLower(p.Board)
+	}
+	if board, ok := LookupBoard(p.Type); ok {
+		return board
+	}
+	return "buddy"
+}
+
+// LookupBoard returns board of the given printer type, e.g. "MK3.5" or "SL1S"
+func LookupBoard(printerType string) (string, bool) {
+	board, ok := printerBoards[NormalizeType(printerType)]
+	return board, ok
+}
+
+// NormalizeType returns printer type in upper case without spaces, dots and dashes, e.g. "Core One" as "COREONE"
+func NormalizeType(printerType string) string {
+	return strings.ToUpper(strings.NewReplacer(" ", "", ".", "", "-", "").Replace(printerType))
+}
+
+// Module struct containing credentials used by the probe endpoint for printers that are not in the printers list
+type Module struct {
+	Username string `yaml:"username,omitempty"`
+	Password string `yaml:"password,omitempty"`
+	Apikey   string `yaml:"apikey,omitempty"`
+	Type     string `yaml:"type,omitempty"`
 }
 
 // LoadConfig function to load and parse the configuration file
 func LoadConfig(path string, prusaLinkScrapeTimeout int) (Config, error) {
-	var config Config
 	file, err := os.ReadFile(path)
 
 	if err != nil {
-		return config, err
+		return Config{}, err
 	}
 
-	if err := yaml.Unmarshal(file, &config); err != nil {
+	return ParseConfig(file, prusaLinkScrapeTimeout)
+}
+
+// ParseConfig parses contents of the configuration file
+func ParseConfig(contents []byte, prusaLinkScrapeTimeout int) (Config, error) {
+	var config Config
+	if err := yaml.Unmarshal(contents, &config); err != nil {
 		return config, err
 	}
 	config.Exporter.ScrapeTimeout = prusaLinkScrapeTimeout
 
-	return config, err
+	return config, nil
+}
+
+// Validate checks that the configuration can be used by the exporter
+func (c Config) Validate() error {
+	seen := make(map[string]bool, len(c.Printers))
+	for i, printer := range c.Printers {
+		if printer.Address == "" {
+			return fmt.Errorf("printer #%d (%s) has no address", i, printer.Name)
+		}
+		if seen[printer.Address] {
+			return fmt.Errorf("printer address %s is configured more than once", printer.Address)
+		}
+		seen[printer.Address] = true
+
+		if printer.Mac != "" && !macRE.MatchString(NormalizeMac(printer.Mac)) {
+			return fmt.Errorf("invalid mac %s of printer %s", printer.Mac, printer.Address)
+		}
+
+		switch printer.Board {
+		case "", "buddy", "einsy", "sl":
+		default:
+			return fmt.Errorf("unknown board %s of printer %s", printer.Board, printer.Address)
+		}
+	}
+
+	for _, subnet := range c.Discovery.Subnets {
+		_, network, err := net.ParseCIDR(subnet)
+		if err != nil {
+			return fmt.Errorf("invalid discovery subnet %s: %v", subnet, err)
+		}
+		if ones, bits := network.Mask.Size(); bits-ones > 12 {
+			return fmt.Errorf("discovery subnet %s is too large, use /20 or smaller", subnet)
+		}
+	}
+
+	for source, rule := range c.UDP.Catalog {
+		if err := rule.Validate(); err != nil {
+			return fmt.Errorf("udp catalog rule %s: %v", source, err)
+		}
+	}
+
+	for _, pattern := range c.UDP.Filter.Patterns() {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid udp filter expression %s: %v", pattern, err)
+		}
+	}
+	for _, cidr := range c.UDP.Sources.AllowedCIDRs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("invalid udp source network %s: %v", cidr, err)
+		}
+	}
+	for _, listener := range c.UDP.Listeners {
+		if listener.Address == "" {
+			return fmt.Errorf("udp listener has no address")
+		}
+		switch listener.Protocol {
+		case "", "udp", "tcp":
+		case "tls":
+			if listener.CertFile == "" || listener.KeyFile == "" {
+				return fmt.Errorf("tls listener %s needs cert_file and key_file", listener.Address)
+			}
+		default:
+			return fmt.Errorf("unknown protocol %s of udp listener %s", listener.Protocol, listener.Address)
+		}
+		switch listener.Format {
+		case "", "rfc5424", "rfc3164", "automatic":
+		case "line":
+			if listener.Protocol != "" && listener.Protocol != "udp" {
+				return fmt.Errorf("line protocol listener %s must use udp", listener.Address)
+			}
+		default:
+			return fmt.Errorf("unknown format %s of udp listener %s", listener.Format, listener.Address)
+		}
+	}
+	if c.History.RetentionDays < 0 || c.History.MaxJobs < 0 {
+		return fmt.Errorf("history retention must not be negative")
+	}
+	if limits := c.UDP.Limits; limits.MaxFamilies < 0 || limits.MaxSeries < 0 || limits.MaxFamiliesTotal < 0 || limits.MaxSeriesTotal < 0 {
+		return fmt.Errorf("udp limits must not be negative")
+	}
+
+	for _, token := range c.Control.Tokens {
+		if token.Token == "" {
+			return fmt.Errorf("control token %s is empty", token.Name)
+		}
+	}
+
+	for _, printer := range c.Control.Printers {
+		for _, action := range printer.Actions {
+			switch action {
+			case "pause", "resume", "stop":
+			default:
+				return fmt.Errorf("unknown control action %s for printer %s", action, printer.Name)
+			}
+		}
+	}
+	return nil
+}
+
+var metricNameRE = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+var labelNameRE = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+var macRE = regexp.MustCompile(`^[0-9a-f]{12}$`)
+
+// NormalizeMac returns mac address in lowercase without separators, so it can be compared
+func NormalizeMac(mac string) string {
+	return strings.ToLower(strings.NewReplacer(":", "", "-", "", ".", "").Replace(mac))
+}
+
+// Validate checks that the rule produces valid metric and label names and keeps labels identifying the printer
+func (r MetricRule) Validate() error {
+	if !metricNameRE.MatchString(r.Name) {
+		return fmt.Errorf("invalid metric name %q", r.Name)
+	}
+	labels := []string{}
+	for label := range r.Labels {
+		labels = append(labels, label)
+	}
+	for from, to := range r.RenameLabels {
+		if from == "mac" || from == "ip" {
+			return fmt.Errorf("label %s identifies the printer and cannot be renamed", from)
+		}
+		labels = append(labels, to)
+	}
+	if r.FieldLabel != "" {
+		labels = append(labels, r.FieldLabel)
+	}
+	for _, label := range labels {
+		if !labelNameRE.MatchString(label) || strings.HasPrefix(label, "__") {
+			return fmt.Errorf("invalid label name %q", label)
+		}
+		if label == "mac" || label == "ip" {
+			return fmt.Errorf("label %s is set from the printer and cannot be overridden", label)
+		}
+	}
+	return nil
 }
 
 // GetLogLevel function to parse the log level for zerolog
@@ -0,0 +1,175 @@
+package control
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/pstrobl96/prusa_exporter/config"
+	prusalink "github.com/pstrobl96/prusa_exporter/prusalink/buddy"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// actions maps names of actions to PrusaLink job control functions
+var actions = map[string]func(config.Printers, int) error{
+	"pause":  prusalink.PauseJob,
+	"resume": prusalink.ResumeJob,
+	"stop":   prusalink.StopJob,
+}
+
+// Handler handles POST /api/printers/{name}/job/{action} requests
+type Handler struct {
+	mu            sync.RWMutex
+	configuration config.Config
+
+	audit zerolog.Logger
+}
+
+type result struct {
+	Printer string `json:"printer"`
+	Action  string `json:"action"`
+	JobID   int    `json:"job_id,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// NewHandler returns a new Handler. Commands are audited to the audit_log file or to the exporter log if not set.
+func NewHandler(cfg config.Config) (*Handler, error) {
+	audit := log.Logger
+	if cfg.Control.AuditLog != "" {
+		file, err := os.OpenFile(cfg.Control.AuditLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o640)
+		if err != nil {
+			return nil, err
+		}
+		audit = zerolog.New(file).With().Timestamp().Logger()
+	}
+
+	return &Handler{
+		configuration: cfg,
+		audit:         audit.With().Str("component", "audit").Logger(),
+	}, nil
+}
+
+// Reload swaps the printers, tokens and allowlist. Change of audit log needs restart.
+func (h *Handler) Reload(cfg config.Config) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.configuration = cfg
+}
+
+// ServeHTTP implements http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	res := result{
+		Printer: r.PathValue("name"),
+		Action:  r.PathValue("action"),
+	}
+
+	h.mu.RLock()
+	cfg := h.configuration
+	h.mu.RUnlock()
+
+	client, ok := authenticate(cfg.Control.Tokens, r)
+	// audit records are written regardless of the log level
+	event := h.audit.Log().
+		Str("client", client).
+		Str("remote_addr", r.RemoteAddr).
+		Str("printer", res.Printer).
+		Str("action", res.Action)
+
+	status := h.execute(cfg, ok, &res)
+	if res.Error != "" {
+		event = event.Str("error", res.Error)
+	}
+	event.Int("job_id", res.JobID).Int("status", status).Msg("Printer control command")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(res)
+}
+
+// execute checks the command against allowlist and sends it to the printer. Returns HTTP status code.
+func (h *Handler) execute(cfg config.Config, authenticated bool, res *result) int {
+	if !authenticated {
+		res.Error = "unauthorized"
+		return http.StatusUnauthorized
+	}
+
+	control, ok := actions[res.Action]
+	if !ok {
+		res.Error = "unknown action"
+		return http.StatusNotFound
+	}
+
+	if !allowed(cfg.Control.Printers, res.Printer, res.Action) {
+		res.Error = "action is not allowed for this printer"
+		return http.StatusForbidden
+	}
+
+	printer, ok := findPrinter(cfg.Printers, res.Printer)
+	if !ok {
+		res.Error = "unknown printer"
+		return http.StatusNotFound
+	}
+
+	// jobs are controlled by v1 API, which only Buddy printers have
+	if printer.GetBoard() != "buddy" {
+		res.Error = "printer with " + printer.GetBoard() + " board can't be controlled"
+		return http.StatusBadRequest
+	}
+
+	status, err := prusalink.GetStatus(printer)
+	if err != nil {
+		res.Error = err.Error()
+		return http.StatusBadGateway
+	}
+
+	res.JobID = int(status.Job.ID)
+	if res.JobID == 0 {
+		res.Error = "printer has no job"
+		return http.StatusConflict
+	}
+
+	if err := control(printer, res.JobID); err != nil {
+		res.Error = err.Error()
+		return http.StatusBadGateway
+	}
+
+	return http.StatusOK
+}
+
+// authenticate returns name of the client with bearer token from the request
+func authenticate(tokens []config.ControlToken, r *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return "", false
+	}
+
+	for _, t := range tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t.Token)) == 1 {
+			return t.Name, true
+		}
+	}
+	return "", false
+}
+
+func allowed(printers []config.ControlPrinter, name string, action string) bool {
+	for _, printer := range printers {
+		if printer.Name == name && slices.Contains(printer.Actions, action) {
+			return true
+		}
+	}
+	return false
+}
+
+func findPrinter(printers []config.Printers, name string) (config.Printers, bool) {
+	for _, printer := range printers {
+		if printer.Name == name {
+			return printer, true
+		}
+	}
+	return config.Printers{}, false
+}
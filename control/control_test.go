@@ -0,0 +1,118 @@
+package control
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pstrobl96/prusa_exporter/config"
+	"github.com/rs/zerolog"
+)
+
+func TestHandler(t *testing.T) {
+	var commands []string
+	printer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" && r.URL.Path == "/api/v1/status" {
+			w.Write([]byte(`{"job":{"id":42},"printer":{"state":"PRINTING"}}`))
+			return
+		}
+		commands = append(commands, r.Method+" "+r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer printer.Close()
+
+	var cfg config.Config
+	address := strings.TrimPrefix(printer.URL, "http://")
+	cfg.Printers = []config.Printers{
+		{Name: "mk4", Address: address, Apikey: "key"},
+		{Name: "mk3s", Address: address, Apikey: "key", Type: "I3MK3S"},
+		{Name: "sl1s", Address: address, Apikey: "key", Type: "SL1S"},
+	}
+	cfg.Control.Tokens = []config.ControlToken{{Name: "grafana", Token: "secret"}}
+	cfg.Control.AuditLog = filepath.Join(t.TempDir(), "audit.log")
+	cfg.Control.Printers = []config.ControlPrinter{
+		{Name: "mk4", Actions: []string{"pause", "stop"}},
+		{Name: "mk3s", Actions: []string{"pause"}},
+		{Name: "sl1s", Actions: []string{"pause"}},
+	}
+
+	// commands are audited even when the exporter logs only errors
+	level := zerolog.GlobalLevel()
+	zerolog.SetGlobalLevel(zerolog.ErrorLevel)
+	t.Cleanup(func() { zerolog.SetGlobalLevel(level) })
+
+	handler, err := NewHandler(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("POST /api/printers/{name}/job/{action}", handler)
+
+	type auditRecord struct {
+		Client  string `json:"client"`
+		Printer string `json:"printer"`
+		Action  string `json:"action"`
+		JobID   int    `json:"job_id"`
+		Status  int    `json:"status"`
+		Error   string `json:"error"`
+	}
+	cases := []struct {
+		path   string
+		token  string
+		status int
+		audit  auditRecord
+	}{
+		{"/api/printers/mk4/job/pause", "wrong", http.StatusUnauthorized, auditRecord{"", "mk4", "pause", 0, 401, "unauthorized"}},
+		{"/api/printers/mk4/job/resume", "secret", http.StatusForbidden, auditRecord{"grafana", "mk4", "resume", 0, 403, "action is not allowed for this printer"}},
+		{"/api/printers/xl/job/pause", "secret", http.StatusForbidden, auditRecord{"grafana", "xl", "pause", 0, 403, "action is not allowed for this printer"}},
+		{"/api/printers/mk4/job/dance", "secret", http.StatusNotFound, auditRecord{"grafana", "mk4", "dance", 0, 404, "unknown action"}},
+		{"/api/printers/mk4/job/cancel", "secret", http.StatusNotFound, auditRecord{"grafana", "mk4", "cancel", 0, 404, "unknown action"}},
+		{"/api/printers/mk3s/job/pause", "secret", http.StatusBadRequest, auditRecord{"grafana", "mk3s", "pause", 0, 400, "printer with einsy board can't be controlled"}},
+		{"/api/printers/sl1s/job/pause", "secret", http.StatusBadRequest, auditRecord{"grafana", "sl1s", "pause", 0, 400, "printer with sl board can't be controlled"}},
+		{"/api/printers/mk4/job/pause", "secret", http.StatusOK, auditRecord{"grafana", "mk4", "pause", 42, 200, ""}},
+		{"/api/printers/mk4/job/stop", "secret", http.StatusOK, auditRecord{"grafana", "mk4", "stop", 42, 200, ""}},
+	}
+
+	for _, tc := range cases {
+		req := httptest.NewRequest("POST", tc.path, nil)
+		req.Header.Set("Authorization", "Bearer "+tc.token)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+
+		if rec.Code != tc.status {
+			t.Errorf("POST %s: got status %d, want %d (%s)", tc.path, rec.Code, tc.status, rec.Body.String())
+		}
+	}
+
+	want := []string{"PUT /api/v1/job/42/pause", "DELETE /api/v1/job/42"}
+	if strings.Join(commands, ",") != strings.Join(want, ",") {
+		t.Errorf("printer commands: got %v, want %v", commands, want)
+	}
+
+	file, err := os.Open(cfg.Control.AuditLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var audited []auditRecord
+	for scanner := bufio.NewScanner(file); scanner.Scan(); {
+		var record auditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("audit line %q: %v", scanner.Text(), err)
+		}
+		audited = append(audited, record)
+	}
+	if len(audited) != len(cases) {
+		t.Fatalf("audit log: got %d records, want %d", len(audited), len(cases))
+	}
+	for i, tc := range cases {
+		if audited[i] != tc.audit {
+			t.Errorf("POST %s: got audit record %+v, want %+v", tc.path, audited[i], tc.audit)
+		}
+	}
+}
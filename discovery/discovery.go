@@ -0,0 +1,423 @@
+package discovery
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/mdns"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/pstrobl96/prusa_exporter/config"
+	prusalink "github.com/pstrobl96/prusa_exporter/prusalink/buddy"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultInterval = 5 * time.Minute
+	// scanWorkers is number of addresses probed at once during subnet scan
+	scanWorkers = 32
+	// expireAfter is number of discovery runs after which a printer that was not found again is forgotten
+	expireAfter = 3
+)
+
+var defaultServices = []string{"_http._tcp", "_octoprint._tcp"}
+
+// candidate is an address where a printer might be running
+type candidate struct {
+	address string
+	name    string
+	source  string
+}
+
+type discoveredPrinter struct {
+	printer config.Printers
+	source  string
+	seen    time.Time
+}
+
+// Discoverer finds PrusaLink printers on the network and merges them with the configured ones.
+// It also detects boards of configured printers of unknown type, so they are handled by the right collector.
+type Discoverer struct {
+	mu         sync.Mutex
+	static     config.Config
+	discovered map[string]discoveredPrinter
+	boards     map[string]string // detected boards by printer address
+	apply      []func(config.Config)
+	reload     chan struct{}
+
+	desc *prometheus.Desc
+}
+
+// NewDiscoverer returns a new Discoverer. Merged configuration is handed to every apply function after every change.
+func NewDiscoverer(cfg config.Config, apply ...func(config.Config)) *Discoverer {
+	return &Discoverer{
+		static:     cfg,
+		discovered: make(map[string]discoveredPrinter),
+		boards:     make(map[string]string),
+		apply:      apply,
+		reload:     make(chan struct{}, 1),
+		desc: prometheus.NewDesc("prusa_discovered_printer_info",
+			"Returns information about printers found by discovery. Label configured tells if the printer is in the configuration file.",
+			[]string{"printer_address", "printer_model", "printer_name", "source", "configured"}, nil),
+	}
+}
+
+// Reload sets the configuration from file and applies it merged with discovered printers
+func (d *Discoverer) Reload(cfg config.Config) {
+	d.mu.Lock()
+	d.static = cfg
+	merged := d.merged()
+	d.mu.Unlock()
+
+	d.applyAll(merged)
+
+	select {
+	case d.reload <- struct{}{}:
+	default:
+	}
+}
+
+// Run discovers printers periodically. It returns immediately when discovery is not configured.
+func (d *Discoverer) Run() {
+	for {
+		d.mu.Lock()
+		cfg := d.static
+		d.mu.Unlock()
+
+		interval := defaultInterval
+		if cfg.Discovery.Interval > 0 {
+			interval = time.Duration(cfg.Discovery.Interval) * time.Second
+		}
+
+		detected := d.detectBoards(cfg)
+		if cfg.Discovery.Enabled() {
+			d.discover(cfg, interval)
+		} else if detected {
+			d.mu.Lock()
+			merged := d.merged()
+			d.mu.Unlock()
+			d.applyAll(merged)
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-d.reload:
+		}
+	}
+}
+
+// discover runs all configured discovery methods and applies the merged configuration
+func (d *Discoverer) discover(cfg config.Config, interval time.Duration) {
+	start := time.Now()
+
+	var candidates []candidate
+	if cfg.Discovery.MDNS.Enabled {
+		candidates = append(candidates, browseMDNS(cfg.Discovery)...)
+	}
+	for _, subnet := range cfg.Discovery.Subnets {
+		candidates = append(candidates, scanSubnet(subnet, cfg.Discovery.Template)...)
+	}
+
+	configured := make(map[string]bool, len(cfg.Printers))
+	for _, printer := range cfg.Printers {
+		configured[printer.Address] = true
+	}
+
+	found := make(map[string]discoveredPrinter)
+	for _, c := range candidates {
+		if _, ok := found[c.address]; ok {
+			continue
+		}
+		printer, ok := identify(c, cfg.Discovery.Template)
+		if !ok {
+			continue
+		}
+		if !configured[c.address] {
+			log.Info().Msg("Discovered printer " + printer.Name + " (" + printer.Type + ") at " + c.address + " via " + c.source)
+		}
+		found[c.address] = discoveredPrinter{printer: printer, source: c.source, seen: start}
+	}
+
+	d.mu.Lock()
+	for address, printer := range d.discovered {
+		if _, ok := found[address]; !ok && start.Sub(printer.seen) < expireAfter*interval {
+			found[address] = printer
+		}
+	}
+	d.discovered = found
+	merged := d.merged()
+	d.mu.Unlock()
+
+	log.Debug().Msgf("Discovery found %d printers in %s", len(found), time.Since(start))
+	d.applyAll(merged)
+}
+
+func (d *Discoverer) applyAll(cfg config.Config) {
+	for _, apply := range d.apply {
+		apply(cfg)
+	}
+}
+
+// detectBoards asks configured printers without board and of unknown type for their type.
+// It returns true if a new board was detected.
+func (d *Discoverer) detectBoards(cfg config.Config) bool {
+	detected := false
+	for _, printer := range cfg.Printers {
+		if _, known := config.LookupBoard(printer.Type); known || printer.Board != "" {
+			continue
+		}
+
+		d.mu.Lock()
+		_, done := d.boards[printer.Address]
+		d.mu.Unlock()
+		if done {
+			continue
+		}
+
+		probed := printer
+		probed.Probe = true // series of exporter metrics are created by the poller of the printer
+		printerType, err := prusalink.GetPrinterType(probed)
+		if err != nil {
+			log.Debug().Msg("Board detection failed at " + printer.Address + " - " + err.Error())
+			continue // printer may be offline, next run tries again
+		}
+
+		board, ok := config.LookupBoard(printerType)
+		if !ok {
+			board = "buddy"
+		}
+		log.Info().Msg("Detected " + board + " board of printer " + printer.Address + " (" + printerType + ")")
+
+		d.mu.Lock()
+		d.boards[printer.Address] = board
+		d.mu.Unlock()
+		detected = detected || board != "buddy"
+	}
+	return detected
+}
+
+// merged returns the configuration from file with detected boards set
+// and discovered printers added when auto_add is enabled
+func (d *Discoverer) merged() config.Config {
+	merged := d.static
+	merged.Printers = append([]config.Printers{}, d.static.Printers...)
+	for i, printer := range merged.Printers {
+		if printer.Board == "" {
+			merged.Printers[i].Board = d.boards[printer.Address]
+		}
+	}
+
+	if !d.static.Discovery.AutoAdd {
+		return merged
+	}
+
+	configured := make(map[string]bool, len(d.static.Printers))
+	for _, printer := range d.static.Printers {
+		configured[printer.Address] = true
+	}
+
+	for address, discovered := range d.discovered {
+		if !configured[address] {
+			merged.Printers = append(merged.Printers, discovered.printer)
+		}
+	}
+	return merged
+}
+
+// Describe implements prometheus.Collector
+func (d *Discoverer) Describe(ch chan<- *prometheus.Desc) {
+	ch <- d.desc
+}
+
+// Collect implements prometheus.Collector
+func (d *Discoverer) Collect(ch chan<- prometheus.Metric) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	configured := make(map[string]bool, len(d.static.Printers))
+	for _, printer := range d.static.Printers {
+		configured[printer.Address] = true
+	}
+
+	for address, discovered := range d.discovered {
+		ch <- prometheus.MustNewConstMetric(d.desc, prometheus.GaugeValue, 1,
+			address, discovered.printer.Type, discovered.printer.Name, discovered.source, strconv.FormatBool(configured[address]))
+	}
+}
+
+// identify checks that PrusaLink runs at the candidate address and detects the printer model.
+// Exporter metrics are not recorded for candidates, nothing would remove them.
+func identify(c candidate, template config.Module) (config.Printers, bool) {
+	printer := config.Printers{
+		Address:  c.address,
+		Username: template.Username,
+		Password: template.Password,
+		Apikey:   template.Apikey,
+		Name:     c.name,
+		Type:     template.Type,
+		Probe:    true,
+	}
+
+	version, err := prusalink.GetVersion(printer)
+	if err != nil || !strings.HasPrefix(version.Text, "Prusa") {
+		log.Trace().Msg("No PrusaLink found at " + c.address)
+		return printer, false
+	}
+
+	if printerType, err := prusalink.GetPrinterType(printer); err == nil && printerType != "unknown" {
+		printer.Type = printerType
+	}
+
+	if printer.Name == "" {
+		printer.Name = version.Hostname
+	}
+	if printer.Name == "" {
+		printer.Name = c.address
+	}
+
+	printer.Probe = false // exporter metrics are recorded by the poller of discovered printer
+	return printer, true
+}
+
+// browseMDNS returns addresses of all instances of configured DNS-SD services
+func browseMDNS(cfg config.Discovery) []candidate {
+	services := cfg.MDNS.Services
+	if len(services) == 0 {
+		services = defaultServices
+	}
+	domain := cfg.MDNS.Domain
+	if domain == "" {
+		domain = "local"
+	}
+	timeout := time.Duration(cfg.MDNS.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+
+	var candidates []candidate
+	for _, service := range services {
+		entries := make(chan *mdns.ServiceEntry, 32)
+		done := make(chan struct{})
+
+		// mdns keeps writing to entries after they are sent, their fields are read only when the query is over
+		var received []*mdns.ServiceEntry
+		go func() {
+			defer close(done)
+			for entry := range entries {
+				received = append(received, entry)
+			}
+		}()
+
+		err := mdns.Query(&mdns.QueryParam{
+			Service: service,
+			Domain:  domain,
+			Timeout: timeout,
+			Entries: entries,
+		})
+		close(entries)
+		<-done
+
+		if err != nil {
+			log.Error().Msg("Error while browsing mDNS service " + service + " - " + err.Error())
+		}
+
+		for _, entry := range received {
+			if entry.AddrV4 == nil {
+				continue
+			}
+			candidates = append(candidates, candidate{
+				address: hostPort(entry.AddrV4.String(), entry.Port),
+				name:    instanceName(entry.Name, service),
+				source:  "mdns",
+			})
+		}
+	}
+	return candidates
+}
+
+// instanceName returns the instance part of a DNS-SD service instance name
+func instanceName(name string, service string) string {
+	if i := strings.Index(name, "."+service); i > 0 {
+		name = name[:i]
+	}
+	return strings.ReplaceAll(name, "\\ ", " ")
+}
+
+// hostPort returns address of the printer, port is left out if it is the default http port
+func hostPort(host string, port int) string {
+	if port == 0 || port == 80 {
+		return host
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// scanSubnet probes every host address of the subnet and returns those where a web server answers
+func scanSubnet(subnet string, template config.Module) []candidate {
+	ip, network, err := net.ParseCIDR(subnet)
+	if err != nil {
+		log.Error().Msg("Invalid discovery subnet " + subnet + " - " + err.Error())
+		return nil
+	}
+
+	addresses := make(chan string)
+	go func() {
+		defer close(addresses)
+		ones, bits := network.Mask.Size()
+		for ip = ip.Mask(network.Mask); network.Contains(ip); ip = nextIP(ip) {
+			if bits-ones > 1 && (ip.Equal(network.IP) || !network.Contains(nextIP(ip))) {
+				continue // network and broadcast address
+			}
+			addresses <- ip.String()
+		}
+	}()
+
+	var (
+		mu         sync.Mutex
+		wg         sync.WaitGroup
+		candidates []candidate
+	)
+	for range scanWorkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for address := range addresses {
+				if !probe(address, template) {
+					continue
+				}
+				mu.Lock()
+				candidates = append(candidates, candidate{address: address, source: "scan"})
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	return candidates
+}
+
+// probe returns true if a web server that may be PrusaLink answers at the address.
+// Printers with digest authentication answer 401, they are identified with credentials of the template later.
+func probe(address string, template config.Module) bool {
+	ok, err := prusalink.ProbePrinter(config.Printers{
+		Address:  address,
+		Username: template.Username,
+		Password: template.Password,
+		Apikey:   template.Apikey,
+		Probe:    true,
+	})
+	return err == nil && ok
+}
+
+func nextIP(ip net.IP) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			break
+		}
+	}
+	return next
+}
@@ -0,0 +1,196 @@
+package discovery
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/mdns"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/pstrobl96/prusa_exporter/config"
+	prusalink "github.com/pstrobl96/prusa_exporter/prusalink/buddy"
+)
+
+func newFakePrinter(t *testing.T) (*httptest.Server, string, int) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/version":
+			w.Write([]byte(`{"api":"2.0.0","server":"2.1.2","text":"PrusaLink","hostname":"PrusaXL"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	host, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return server, host, p
+}
+
+func TestDiscovererMergesDiscoveredPrinters(t *testing.T) {
+	server, host, port := newFakePrinter(t)
+	defer server.Close()
+
+	var cfg config.Config
+	cfg.Printers = []config.Printers{{Address: "10.0.0.1", Name: "static"}}
+	cfg.Discovery.AutoAdd = true
+	cfg.Discovery.Template = config.Module{Apikey: "secret"}
+
+	var applied config.Config
+	d := NewDiscoverer(cfg, func(c config.Config) { applied = c })
+
+	printer, ok := identify(candidate{address: hostPort(host, port), name: "xl", source: "mdns"}, cfg.Discovery.Template)
+	if !ok {
+		t.Fatal("identify: PrusaLink not recognised")
+	}
+	if printer.Type != "XL" || printer.Name != "xl" || printer.Apikey != "secret" {
+		t.Errorf("identify: unexpected printer %+v", printer)
+	}
+
+	if _, ok := identify(candidate{address: hostPort(host, port)}, config.Module{Apikey: "wrong"}); ok {
+		t.Error("identify: printer with wrong credentials must not be recognised")
+	}
+
+	d.discovered[printer.Address] = discoveredPrinter{printer: printer, source: "mdns", seen: time.Now()}
+	d.Reload(cfg)
+
+	if len(applied.Printers) != 2 || applied.Printers[0].Name != "static" || applied.Printers[1].Name != "xl" {
+		t.Errorf("merged printers: got %+v", applied.Printers)
+	}
+
+	cfg.Discovery.AutoAdd = false
+	d.Reload(cfg)
+	if len(applied.Printers) != 1 {
+		t.Errorf("merged printers without auto_add: got %+v", applied.Printers)
+	}
+}
+
+func TestBrowseMDNS(t *testing.T) {
+	server, host, port := newFakePrinter(t)
+	defer server.Close()
+
+	service, err := mdns.NewMDNSService("Core One", "_http._tcp", "", "coreone.local.", port, []net.IP{net.ParseIP(host)}, []string{"path=/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	responder, err := mdns.NewServer(&mdns.Config{Zone: service})
+	if err != nil {
+		t.Skipf("multicast is not available: %v", err)
+	}
+	defer responder.Shutdown()
+
+	var cfg config.Discovery
+	cfg.MDNS.Enabled = true
+	cfg.MDNS.Services = []string{"_http._tcp"}
+	cfg.MDNS.Timeout = 1
+
+	candidates := browseMDNS(cfg)
+	for _, c := range candidates {
+		if c.address == hostPort(host, port) {
+			if c.name != "Core One" || c.source != "mdns" {
+				t.Errorf("unexpected candidate %+v", c)
+			}
+			return
+		}
+	}
+	t.Skipf("mDNS response was not received, multicast is probably blocked: %+v", candidates)
+}
+
+func TestNextIP(t *testing.T) {
+	if got := nextIP(net.ParseIP("192.168.1.255").To4()).String(); got != "192.168.2.0" {
+		t.Errorf("nextIP: got %s, want 192.168.2.0", got)
+	}
+}
+
+func TestDetectBoards(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"api":"0.1","hostname":"prusa-sl1","server":"1.1.0","text":"Prusa SLA 1.0.5"}`))
+	}))
+	defer server.Close()
+	address := server.Listener.Addr().String()
+
+	var cfg config.Config
+	cfg.Printers = []config.Printers{
+		{Address: address, Apikey: "secret"},
+		{Address: "10.0.0.1", Type: "MK4"},
+	}
+
+	var applied config.Config
+	d := NewDiscoverer(cfg, func(c config.Config) { applied = c })
+
+	if !d.detectBoards(cfg) {
+		t.Fatal("detectBoards: SL board not detected")
+	}
+	if d.detectBoards(cfg) {
+		t.Error("detectBoards: board must be detected only once")
+	}
+
+	d.Reload(cfg)
+	if applied.Printers[0].GetBoard() != "sl" || applied.Printers[1].GetBoard() != "buddy" {
+		t.Errorf("unexpected boards %q and %q", applied.Printers[0].GetBoard(), applied.Printers[1].GetBoard())
+	}
+	if cfg.Printers[0].Board != "" {
+		t.Error("configuration from file must not be modified")
+	}
+}
+
+func TestProbe(t *testing.T) {
+	digest := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("WWW-Authenticate", `Digest realm="Printer API", nonce="abc", qop="auth"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer digest.Close()
+	other := httptest.NewServer(http.NotFoundHandler())
+	defer other.Close()
+
+	template := config.Module{Username: "maker", Password: "secret"}
+	if !probe(digest.Listener.Addr().String(), template) {
+		t.Error("probe: printer with digest authentication must be found")
+	}
+	if probe(other.Listener.Addr().String(), template) {
+		t.Error("probe: server without PrusaLink must not be found")
+	}
+}
+
+func TestDiscoveryLeavesNoExporterMetrics(t *testing.T) {
+	server, host, port := newFakePrinter(t)
+	defer server.Close()
+	address := hostPort(host, port)
+
+	template := config.Module{Apikey: "secret"}
+	if !probe(address, template) {
+		t.Fatal("probe: printer not found")
+	}
+	printer, ok := identify(candidate{address: address, source: "scan"}, template)
+	if !ok {
+		t.Fatal("identify: PrusaLink not recognised")
+	}
+	if printer.Probe {
+		t.Error("identify: discovered printer must be polled with exporter metrics")
+	}
+	var cfg config.Config
+	cfg.Printers = []config.Printers{{Address: address, Apikey: "secret"}}
+	NewDiscoverer(cfg).detectBoards(cfg)
+
+	// nothing would remove exporter metrics of hosts found by discovery
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(prusalink.NewCollector(config.Config{}))
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "printer_address" && label.GetValue() == address {
+					t.Errorf("%s: series of discovered host %s left behind", family.GetName(), address)
+				}
+			}
+		}
+	}
+}
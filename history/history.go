@@ -0,0 +1,308 @@
+package history
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pstrobl96/prusa_exporter/config"
+	prusalink "github.com/pstrobl96/prusa_exporter/prusalink/buddy"
+	"github.com/rs/zerolog/log"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	jobsBucket = []byte("jobs")
+	// metaBucket keeps number of jobs under countKey, so it's not counted on every added job
+	metaBucket = []byte("meta")
+	countKey   = []byte("jobs")
+)
+
+// Job is a print job stored in the history
+type Job struct {
+	Printer     string    `json:"printer"`
+	Address     string    `json:"address"`
+	Model       string    `json:"model,omitempty"`
+	ID          int       `json:"job_id"`
+	Name        string    `json:"name"`
+	DisplayName string    `json:"display_name,omitempty"`
+	Path        string    `json:"path,omitempty"`
+	Filament    string    `json:"filament,omitempty"`
+	SlicedModel string    `json:"sliced_model,omitempty"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	Duration    float64   `json:"duration_seconds"`
+	Outcome     string    `json:"outcome"`
+}
+
+var csvHeader = []string{"printer", "address", "model", "job_id", "name", "display_name", "path", "filament",
+	"sliced_model", "start", "end", "duration_seconds", "outcome"}
+
+func (j Job) csvRecord() []string {
+	return []string{csvCell(j.Printer), csvCell(j.Address), csvCell(j.Model), strconv.Itoa(j.ID), csvCell(j.Name),
+		csvCell(j.DisplayName), csvCell(j.Path), csvCell(j.Filament), csvCell(j.SlicedModel),
+		j.Start.Format(time.RFC3339), j.End.Format(time.RFC3339), strconv.FormatFloat(j.Duration, 'f', -1, 64), j.Outcome}
+}
+
+// csvCell prefixes text that spreadsheets would evaluate as a formula, names of jobs come from the printers
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// Store keeps ended print jobs in a local database file, jobs are ordered by their end
+type Store struct {
+	db        *bolt.DB
+	retention time.Duration
+	maxJobs   int
+}
+
+// Open opens or creates the database of the history. Change of the configuration needs restart.
+func Open(cfg config.History) (*Store, error) {
+	db, err := bolt.Open(cfg.Path, 0o640, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		jobs, err := tx.CreateBucketIfNotExists(jobsBucket)
+		if err != nil {
+			return err
+		}
+		meta, err := tx.CreateBucketIfNotExists(metaBucket)
+		if err != nil || meta.Get(countKey) != nil {
+			return err
+		}
+		// history created without the count
+		count := 0
+		c := jobs.Cursor()
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			count++
+		}
+		return setJobCount(tx, count)
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	store := &Store{
+		db:        db,
+		retention: time.Duration(cfg.RetentionDays) * 24 * time.Hour,
+		maxJobs:   cfg.MaxJobs,
+	}
+	if err := store.Prune(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// Prune removes jobs over the retention limits
+func (s *Store) Prune() error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return s.prune(tx)
+	})
+}
+
+// PruneEvery removes jobs over the retention limits periodically, so they expire even when no job ends
+func (s *Store) PruneEvery(interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := s.Prune(); err != nil {
+			log.Error().Msg("Error while removing old jobs from history - " + err.Error())
+		}
+	}
+}
+
+// Close closes the database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Record stores the ended job, it is registered with prusalink.OnJobEnd
+func (s *Store) Record(ended prusalink.EndedJob) {
+	job := Job{
+		Printer:     ended.Printer.Name,
+		Address:     ended.Printer.Address,
+		Model:       ended.Printer.Type,
+		ID:          ended.ID,
+		Name:        ended.Name,
+		DisplayName: ended.DisplayName,
+		Path:        ended.Path,
+		Filament:    ended.Filament,
+		SlicedModel: ended.SlicedModel,
+		Start:       ended.Start.UTC(),
+		End:         ended.End.UTC(),
+		Duration:    ended.Duration,
+		Outcome:     ended.Outcome,
+	}
+	if job.Printer == "" {
+		job.Printer = job.Address
+	}
+
+	if err := s.Add(job); err != nil {
+		log.Error().Msg("Error while storing job " + strconv.Itoa(job.ID) + " of " + job.Printer + " to history - " + err.Error())
+	}
+}
+
+// Add stores the job and removes jobs over the retention limits
+func (s *Store) Add(job Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(jobsBucket)
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		if err := b.Put(jobKey(job.End, seq), data); err != nil {
+			return err
+		}
+		if err := setJobCount(tx, jobCount(tx)+1); err != nil {
+			return err
+		}
+		return s.prune(tx)
+	})
+}
+
+// jobCount returns number of stored jobs
+func jobCount(tx *bolt.Tx) int {
+	value := tx.Bucket(metaBucket).Get(countKey)
+	if len(value) != 8 {
+		return 0
+	}
+	return int(binary.BigEndian.Uint64(value))
+}
+
+func setJobCount(tx *bolt.Tx, count int) error {
+	value := make([]byte, 8)
+	binary.BigEndian.PutUint64(value, uint64(max(count, 0)))
+	return tx.Bucket(metaBucket).Put(countKey, value)
+}
+
+// jobKey orders jobs by end time, sequence keeps jobs that ended at the same time apart
+func jobKey(end time.Time, seq uint64) []byte {
+	key := make([]byte, 16)
+	binary.BigEndian.PutUint64(key, uint64(max(end.UnixNano(), 0)))
+	binary.BigEndian.PutUint64(key[8:], seq)
+	return key
+}
+
+// prune removes jobs that ended before the retention period and the oldest jobs over maxJobs
+func (s *Store) prune(tx *bolt.Tx) error {
+	count := jobCount(tx)
+	excess := 0
+	if s.maxJobs > 0 {
+		excess = count - s.maxJobs
+	}
+	var cutoff []byte
+	if s.retention > 0 {
+		cutoff = jobKey(time.Now().Add(-s.retention), 0)
+	}
+
+	removed := 0
+	c := tx.Bucket(jobsBucket).Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.First() {
+		if excess <= 0 && (cutoff == nil || bytes.Compare(k, cutoff) >= 0) {
+			break
+		}
+		if err := c.Delete(); err != nil {
+			return err
+		}
+		excess--
+		removed++
+	}
+	if removed == 0 {
+		return nil
+	}
+	return setJobCount(tx, count-removed)
+}
+
+// Query returns jobs of the printer, given by name or address, that ended between since and until.
+// Empty printer matches all printers, zero times are not limiting. Jobs past retention are never returned.
+func (s *Store) Query(printer string, since time.Time, until time.Time) ([]Job, error) {
+	if s.retention > 0 {
+		if expired := time.Now().Add(-s.retention); since.Before(expired) {
+			since = expired
+		}
+	}
+	jobs := []Job{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(jobsBucket).Cursor()
+		k, v := c.First()
+		if !since.IsZero() {
+			k, v = c.Seek(jobKey(since, 0))
+		}
+		for ; k != nil; k, v = c.Next() {
+			var job Job
+			if err := json.Unmarshal(v, &job); err != nil {
+				return err
+			}
+			if !until.IsZero() && job.End.After(until) {
+				break
+			}
+			if printer == "" || job.Printer == printer || job.Address == printer {
+				jobs = append(jobs, job)
+			}
+		}
+		return nil
+	})
+	return jobs, err
+}
+
+// parseTime accepts RFC 3339 time or unix timestamp in seconds, empty value is zero time
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// ServeHTTP implements http.Handler for GET /api/history?printer=&since=&until=.
+// Jobs are returned as JSON, or as CSV with format=csv or Accept: text/csv.
+func (s *Store) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	since, err := parseTime(query.Get("since"))
+	if err != nil {
+		http.Error(w, "invalid since: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	until, err := parseTime(query.Get("until"))
+	if err != nil {
+		http.Error(w, "invalid until: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	jobs, err := s.Query(query.Get("printer"), since, until)
+	if err != nil {
+		log.Error().Msg("Error while reading job history - " + err.Error())
+		http.Error(w, "error while reading job history", http.StatusInternalServerError)
+		return
+	}
+
+	if query.Get("format") == "csv" || r.Header.Get("Accept") == "text/csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		writer := csv.NewWriter(w)
+		writer.Write(csvHeader)
+		for _, job := range jobs {
+			writer.Write(job.csvRecord())
+		}
+		writer.Flush()
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(jobs)
+}
@@ -0,0 +1,186 @@
+package history
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/pstrobl96/prusa_exporter/config"
+	prusalink "github.com/pstrobl96/prusa_exporter/prusalink/buddy"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	store, err := Open(config.History{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	end := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	mk4 := config.Printers{Address: "10.0.0.5", Name: "mk4", Type: "MK4"}
+	xl := config.Printers{Address: "10.0.0.6", Type: "XL"}
+	for i, printer := range []config.Printers{mk4, xl, mk4} {
+		store.Record(prusalink.EndedJob{Printer: printer, ID: 100 + i, Name: "BENCHY.BGC", Filament: "PLA",
+			Start: end.Add(time.Duration(i)*time.Hour - 30*time.Minute), End: end.Add(time.Duration(i) * time.Hour),
+			Duration: 1800, Outcome: "finished"})
+	}
+	store.Close()
+
+	// history is kept across restarts
+	store, err = Open(config.History{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	type testCase struct {
+		Query string
+		IDs   []int
+	}
+	cases := []testCase{
+		{"", []int{100, 101, 102}},
+		{"?printer=mk4", []int{100, 102}},
+		{"?printer=10.0.0.6", []int{101}},
+		{"?since=2026-03-01T12:30:00Z", []int{101, 102}},
+		{"?until=" + end.Add(time.Hour).Format(time.RFC3339), []int{100, 101}},
+		{"?printer=mk4&since=1772366400&until=1772370000", []int{100}},
+	}
+	for _, tc := range cases {
+		rec := httptest.NewRecorder()
+		store.ServeHTTP(rec, httptest.NewRequest("GET", "/api/history"+tc.Query, nil))
+		var jobs []Job
+		if err := json.NewDecoder(rec.Body).Decode(&jobs); err != nil {
+			t.Fatalf("%s: %v", tc.Query, err)
+		}
+		ids := make([]int, len(jobs))
+		for i, job := range jobs {
+			ids[i] = job.ID
+		}
+		if !slices.Equal(ids, tc.IDs) {
+			t.Errorf("%s: got jobs %v, want %v", tc.Query, ids, tc.IDs)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	store.ServeHTTP(rec, httptest.NewRequest("GET", "/api/history?printer=10.0.0.6&format=csv", nil))
+	records, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[1][0] != "10.0.0.6" || records[1][3] != "101" || records[1][9] != "2026-03-01T12:30:00Z" {
+		t.Errorf("unexpected csv %v", records)
+	}
+
+	rec = httptest.NewRecorder()
+	store.ServeHTTP(rec, httptest.NewRequest("GET", "/api/history?since=yesterday", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid since: got %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestRetention(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	store, err := Open(config.History{Path: path, RetentionDays: 30, MaxJobs: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	now := time.Now()
+	for i, end := range []time.Time{now.AddDate(0, 0, -40), now.Add(-4 * time.Hour), now.Add(-3 * time.Hour), now.Add(-2 * time.Hour), now.Add(-time.Hour)} {
+		if err := store.Add(Job{Printer: "mk4", ID: i, End: end}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	jobs, err := store.Query("", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 3 || jobs[0].ID != 2 || jobs[2].ID != 4 {
+		t.Errorf("expected jobs 2-4 to be kept, got %+v", jobs)
+	}
+
+	// number of jobs is kept across restarts, including databases stored without it
+	store.db.Update(func(tx *bolt.Tx) error { return tx.DeleteBucket(metaBucket) })
+	store.Close()
+	store, err = Open(config.History{Path: path, RetentionDays: 30, MaxJobs: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if err := store.Add(Job{Printer: "mk4", ID: 5, End: now}); err != nil {
+		t.Fatal(err)
+	}
+	jobs, err = store.Query("", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 3 || jobs[0].ID != 3 || jobs[2].ID != 5 {
+		t.Errorf("expected jobs 3-5 to be kept, got %+v", jobs)
+	}
+}
+
+func TestCSVFormula(t *testing.T) {
+	store, err := Open(config.History{Path: filepath.Join(t.TempDir(), "history.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	job := Job{Printer: "@mk4", ID: 1, Name: "=HYPERLINK(\"http://example.com\")", Filament: "+PLA", SlicedModel: "-MK4", End: time.Now()}
+	if err := store.Add(job); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	store.ServeHTTP(rec, httptest.NewRequest("GET", "/api/history?format=csv", nil))
+	records, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("unexpected csv %v", records)
+	}
+	for i, expected := range map[int]string{0: "'@mk4", 4: "'" + job.Name, 7: "'+PLA", 8: "'-MK4"} {
+		if records[1][i] != expected {
+			t.Errorf("%s: got %q, want %q", csvHeader[i], records[1][i], expected)
+		}
+	}
+}
+
+func TestRetentionOnOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	store, err := Open(config.History{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for i, end := range []time.Time{now.AddDate(0, 0, -40), now.AddDate(0, 0, -20), now.Add(-time.Hour)} {
+		if err := store.Add(Job{Printer: "mk4", ID: i, End: end}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.Close()
+
+	// retention is applied to jobs stored before, even when no job ends
+	store, err = Open(config.History{Path: path, RetentionDays: 30, MaxJobs: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	jobs, err := store.Query("", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].ID != 2 {
+		t.Errorf("expected job 2 to be kept, got %+v", jobs)
+	}
+}
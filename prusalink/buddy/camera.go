@@ -0,0 +1,83 @@
+package prusalink
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/pstrobl96/prusa_exporter/config"
+	"github.com/rs/zerolog/log"
+)
+
+// cameraSnapshotURL returns path where the latest snapshot of the camera is served
+func cameraSnapshotURL(printerID string, cameraID string) string {
+	return "/printers/" + url.PathEscape(printerID) + "/cameras/" + url.PathEscape(cameraID) + "/snapshot"
+}
+
+// collectCameras sends metrics of cameras of the printer
+func (c *Collector) collectCameras(ch chan<- prometheus.Metric, snap *snapshot) {
+	s, job := snap.printer, snap.job
+
+	for _, camera := range snap.cameras.CameraList {
+		if c.metricEnabled(MetricPrinterCamera) {
+			ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterCamera], prometheus.GaugeValue,
+				1, c.GetLabels(s, job, camera.CameraID, camera.Config.Name, camera.Config.Driver,
+					camera.Config.Resolution, camera.Config.TriggerScheme, cameraSnapshotURL(thumbnailID(s), camera.CameraID))...)
+		}
+
+		for metric, value := range map[MetricName]bool{
+			MetricPrinterCameraConnected:  camera.Connected,
+			MetricPrinterCameraDetected:   camera.Detected,
+			MetricPrinterCameraRegistered: camera.Registered,
+		} {
+			if c.metricEnabled(metric) {
+				ch <- prometheus.MustNewConstMetric(c.metricDesc[metric], prometheus.GaugeValue,
+					BoolToFloat(value), c.GetLabels(s, job, camera.CameraID)...)
+			}
+		}
+	}
+}
+
+// ServeCameraSnapshot handles GET /printers/{name}/cameras/{camera}/snapshot. The latest snapshot is fetched
+// from PrusaLink with credentials of the exporter, so they are not exposed to browsers.
+// Only cameras listed by the printer in the last poll are served.
+func (c *Collector) ServeCameraSnapshot(w http.ResponseWriter, r *http.Request) {
+	name, cameraID := r.PathValue("name"), r.PathValue("camera")
+
+	c.mu.RLock()
+	var printer config.Printers
+	known := false
+	for _, p := range c.configuration.Printers {
+		if thumbnailID(p) != name {
+			continue
+		}
+		printer = p
+		if poller, ok := c.pollers[p.Address]; ok {
+			if snap := poller.snapshot(); snap != nil {
+				for _, camera := range snap.cameras.CameraList {
+					known = known || camera.CameraID == cameraID
+				}
+			}
+		}
+		break
+	}
+	c.mu.RUnlock()
+
+	if !known {
+		http.NotFound(w, r)
+		return
+	}
+
+	image, err := GetCameraSnapshot(printer, cameraID)
+	if err != nil {
+		log.Error().Msg("Error while getting snapshot of camera " + cameraID + " at " + printer.Address + " - " + err.Error())
+		http.Error(w, "snapshot is not available", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", http.DetectContentType(image))
+	w.Header().Set("Content-Length", strconv.Itoa(len(image)))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(image)
+}
@@ -0,0 +1,102 @@
+package prusalink
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/pstrobl96/prusa_exporter/config"
+)
+
+const cameras = `{"camera_list": [{"camera_id": "cam1", "config": {"name": "Buddy3D", "driver": "buddy", "resolution": "1920x1080", "trigger_scheme": "THIRTY_SEC"},
+  "connected": true, "detected": true, "stored": true, "registered": false}]}`
+
+// unchecked hides descriptors of the collector, testutil registry rejects special metrics which are not described
+type unchecked struct{ c *Collector }
+
+func (u unchecked) Describe(ch chan<- *prometheus.Desc) {}
+func (u unchecked) Collect(ch chan<- prometheus.Metric) { u.c.Collect(ch) }
+
+var jpeg = []byte("\xff\xd8\xff\xe0 not really a jpeg")
+
+func newFakePrinter(t *testing.T) *httptest.Server {
+	t.Helper()
+	files := map[string]string{
+		"/api/job":     "../api/buddy/job.json",
+		"/api/printer": "../api/buddy/printer.json",
+		"/api/version": "../api/buddy/version.json",
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/v1/cameras":
+			w.Write([]byte(cameras))
+		case "/api/v1/cameras/cam1/snap":
+			w.Write(jpeg)
+		default:
+			data, err := os.ReadFile(files[r.URL.Path])
+			if err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(data)
+		}
+	}))
+}
+
+func TestCameras(t *testing.T) {
+	server := newFakePrinter(t)
+	defer server.Close()
+
+	var cfg config.Config
+	cfg.Printers = []config.Printers{{Address: strings.TrimPrefix(server.URL, "http://"), Name: "core", Type: "COREONE", Apikey: "secret"}}
+	c := NewCollector(cfg)
+	defer c.Reload(config.Config{})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for c.pollers[cfg.Printers[0].Address].snapshot() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("printer was not polled")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for _, name := range []string{"prusa_camera_info", "prusa_camera_connected", "prusa_camera_detected", "prusa_camera_registered"} {
+		if count := testutil.CollectAndCount(unchecked{c}, name); count != 1 {
+			t.Errorf("%s: expected 1 series, got %d", name, count)
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /printers/{name}/cameras/{camera}/snapshot", c.ServeCameraSnapshot)
+
+	type testCase struct {
+		Path   string
+		Status int
+	}
+	cases := []testCase{
+		{cameraSnapshotURL("core", "cam1"), http.StatusOK},
+		{cameraSnapshotURL("core", "cam2"), http.StatusNotFound},
+		{cameraSnapshotURL("other", "cam1"), http.StatusNotFound},
+	}
+	for _, tc := range cases {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", tc.Path, nil))
+		if rec.Code != tc.Status {
+			t.Errorf("%s: got %d, want %d", tc.Path, rec.Code, tc.Status)
+		}
+		if tc.Status == http.StatusOK {
+			if rec.Header().Get("Content-Type") != "image/jpeg" || rec.Body.String() != string(jpeg) {
+				t.Errorf("%s: unexpected snapshot %s %q", tc.Path, rec.Header().Get("Content-Type"), rec.Body.String())
+			}
+		}
+	}
+}
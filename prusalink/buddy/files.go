@@ -0,0 +1,80 @@
+package prusalink
+
+import (
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pstrobl96/prusa_exporter/config"
+)
+
+// defaultFilesInterval is used when prusalink.files_interval is not set, listing of all files is slow
+const defaultFilesInterval = 300 * time.Second
+
+// FilesInterval returns how often files of printers are listed with the given configuration
+func FilesInterval(config config.Config) time.Duration {
+	if config.PrusaLink.FilesInterval > 0 {
+		return time.Duration(config.PrusaLink.FilesInterval) * time.Second
+	}
+	return defaultFilesInterval
+}
+
+// fileInventory summarizes files of the printer by storage they are stored in
+type fileInventory map[string]*storageFiles
+
+// storageFiles summarizes files of a single storage
+type storageFiles struct {
+	count  map[string]float64 // by extension
+	size   float64
+	newest float64 // upload time of the newest file as unix timestamp
+}
+
+// newFileInventory walks the recursive listing of files from path /api/files
+func newFileInventory(files Files) fileInventory {
+	inventory := fileInventory{}
+	for _, file := range files.Files {
+		inventory.add(storageName(file.Origin), file)
+	}
+	return inventory
+}
+
+func (inventory fileInventory) add(storage string, file File) {
+	if file.Origin != "" {
+		storage = storageName(file.Origin)
+	}
+
+	summary, ok := inventory[storage]
+	if !ok {
+		summary = &storageFiles{count: map[string]float64{}}
+		inventory[storage] = summary
+	}
+
+	if file.Type == "folder" {
+		for _, child := range file.Children {
+			inventory.add(storage, child)
+		}
+		return
+	}
+
+	summary.count[fileExtension(file)]++
+	summary.size += file.Size
+	summary.newest = max(summary.newest, file.Date)
+}
+
+// fileExtension returns lowercase extension of the file. Long name is preferred, USB of Buddy printers has 8.3 names.
+func fileExtension(file File) string {
+	name := file.Display
+	if name == "" {
+		name = file.Name
+	}
+	extension := strings.ToLower(strings.TrimPrefix(path.Ext(name), "."))
+	if extension == "" {
+		return "none"
+	}
+	return extension
+}
+
+// storageName returns name of the storage used as printer_storage label, e.g. usb for /usb/
+func storageName(storagePath string) string {
+	return strings.ToLower(strings.Trim(storagePath, "/"))
+}
@@ -0,0 +1,63 @@
+package prusalink
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+func readFiles(t *testing.T, path string) Files {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files Files
+	if err := json.Unmarshal(data, &files); err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestFileInventoryBuddy(t *testing.T) {
+	inventory := newFileInventory(readFiles(t, "../api/buddy/files.json"))
+
+	usb, ok := inventory["usb"]
+	if !ok || len(inventory) != 1 {
+		t.Fatalf("expected only usb storage, got %v", inventory)
+	}
+	// extension is taken from the long name, not from XLCD-C~1.BGC
+	if usb.count["bgcode"] != 2 || len(usb.count) != 1 {
+		t.Errorf("expected 2 bgcode files, got %v", usb.count)
+	}
+	if usb.newest != 0 {
+		t.Errorf("buddy printer does not send dates, got %v", usb.newest)
+	}
+}
+
+func TestFileInventoryEinsy(t *testing.T) {
+	files := readFiles(t, "../api/einsy/files.json")
+	inventory := newFileInventory(files)
+
+	sdcard, ok := inventory["sdcard"]
+	if !ok {
+		t.Fatalf("expected sdcard storage, got %v", inventory)
+	}
+	if local, ok := inventory["local"]; !ok || len(local.count) != 0 {
+		t.Errorf("expected empty local storage, got %v", local)
+	}
+
+	// size of folders is the size of their files
+	var folderSize float64
+	for _, file := range files.Files {
+		if file.Origin == "sdcard" {
+			folderSize = file.Size
+		}
+	}
+	if sdcard.size != folderSize {
+		t.Errorf("size: got %v, want %v", sdcard.size, folderSize)
+	}
+	if sdcard.count["gcode"] == 0 || sdcard.newest < 1693978230 {
+		t.Errorf("unexpected summary of sdcard: %v files, newest %v", sdcard.count, sdcard.newest)
+	}
+}
@@ -0,0 +1,65 @@
+package prusalink
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/pstrobl96/prusa_exporter/config"
+)
+
+// collectJob sends metrics of the current print job from /api/v1/job, fields of file metadata are sent only if the printer knows them
+func (c *Collector) collectJob(ch chan<- prometheus.Metric, snap *snapshot) {
+	s, job, jobV1 := snap.printer, snap.job, snap.jobV1
+	if jobV1.ID == 0 {
+		return // printer is not printing
+	}
+	meta := jobV1.File.Meta
+
+	gauges := []gauge{
+		{MetricPrinterJobID, jobV1.ID, true},
+		{MetricPrinterJobInaccurateEstimates, BoolToFloat(jobV1.InaccurateEstimates), true},
+		{MetricPrinterJobEstimatedPrintTime, meta.EstimatedPrintTime, meta.EstimatedPrintTime > 0},
+		{MetricPrinterLayerHeight, meta.LayerHeight * 0.001, meta.LayerHeight > 0},
+		{MetricPrinterJobFileSize, jobV1.File.Size, jobV1.File.Size > 0},
+	}
+	for _, g := range gauges {
+		if g.send && c.metricEnabled(g.metric) {
+			ch <- prometheus.MustNewConstMetric(c.metricDesc[g.metric], prometheus.GaugeValue,
+				g.value, c.GetLabels(s, job)...)
+		}
+	}
+
+	if c.metricEnabled(MetricPrinterJobTimeRemaining) {
+		ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterJobTimeRemaining], prometheus.GaugeValue,
+			jobV1.TimeRemaining, c.GetLabels(s, job, "printer")...)
+
+		if meta.EstimatedPrintTime > 0 {
+			ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterJobTimeRemaining], prometheus.GaugeValue,
+				max(meta.EstimatedPrintTime-jobV1.TimePrinting, 0), c.GetLabels(s, job, "slicer")...)
+		}
+	}
+
+	if c.metricEnabled(MetricPrinterJobFilament) && meta.FilamentType != "" {
+		ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterJobFilament], prometheus.GaugeValue,
+			1, c.GetLabels(s, job, meta.FilamentType)...)
+	}
+
+	if meta.PrinterModel == "" {
+		return
+	}
+	if c.metricEnabled(MetricPrinterJobSlicedModel) {
+		ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterJobSlicedModel], prometheus.GaugeValue,
+			1, c.GetLabels(s, job, meta.PrinterModel)...)
+	}
+	if c.metricEnabled(MetricPrinterJobModelMismatch) && s.Type != "" {
+		ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterJobModelMismatch], prometheus.GaugeValue,
+			BoolToFloat(!sameModel(meta.PrinterModel, s.Type)), c.GetLabels(s, job, meta.PrinterModel)...)
+	}
+}
+
+// sameModel returns true if the G-code sliced for the model can be printed by printer of the configured type.
+// Slicer appends IS to models with input shaping, e.g. MK4IS or XLIS, which are the same printers.
+func sameModel(sliced string, printerType string) bool {
+	sliced, printerType = config.NormalizeType(sliced), config.NormalizeType(printerType)
+	return strings.TrimSuffix(sliced, "IS") == strings.TrimSuffix(printerType, "IS")
+}
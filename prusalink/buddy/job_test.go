@@ -0,0 +1,100 @@
+package prusalink
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/pstrobl96/prusa_exporter/config"
+)
+
+func TestSameModel(t *testing.T) {
+	type testCase struct {
+		Sliced string
+		Type   string
+		Same   bool
+	}
+	cases := []testCase{
+		{"MK4IS", "MK4", true},
+		{"XLIS", "XL", true},
+		{"COREONE", "Core One", true},
+		{"MK3.9", "MK39", true},
+		{"MK4S", "MK4", false},
+		{"MINIIS", "MK4", false},
+	}
+
+	for _, tc := range cases {
+		if got := sameModel(tc.Sliced, tc.Type); got != tc.Same {
+			t.Errorf("sameModel(%q, %q): got %v, want %v", tc.Sliced, tc.Type, got, tc.Same)
+		}
+	}
+}
+
+// jobCollector sends only job metrics of the snapshot
+type jobCollector struct {
+	c    *Collector
+	snap *snapshot
+}
+
+func (j jobCollector) Describe(ch chan<- *prometheus.Desc) {}
+func (j jobCollector) Collect(ch chan<- prometheus.Metric) { j.c.collectJob(ch, j.snap) }
+
+func TestCollectJob(t *testing.T) {
+	data, err := os.ReadFile("../api/buddy/v1/job.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var jobV1 JobV1
+	if err := json.Unmarshal(data, &jobV1); err != nil {
+		t.Fatal(err)
+	}
+	jobV1.InaccurateEstimates = true
+	jobV1.File.Meta.PrinterModel = "XLIS"
+	jobV1.File.Meta.FilamentType = "PLA;PLA;PLA;PLA"
+	jobV1.File.Meta.LayerHeight = 0.15
+	jobV1.File.Meta.EstimatedPrintTime = 20160
+
+	var cfg config.Config
+	cfg.PrusaLink.CommonLabels = []string{"printer_name"}
+	c := NewCollector(cfg)
+	snap := &snapshot{printer: config.Printers{Name: "mk4", Type: "MK4"}, jobV1: jobV1}
+
+	expected := `
+# HELP prusa_job_id Returns ID of current print job.
+# TYPE prusa_job_id gauge
+prusa_job_id{printer_name="mk4"} 109
+# HELP prusa_job_time_remaining_seconds Returns time that remains for completion of current print job in seconds, as estimated by the printer or by the slicer.
+# TYPE prusa_job_time_remaining_seconds gauge
+prusa_job_time_remaining_seconds{printer_estimate="printer",printer_name="mk4"} 20100
+prusa_job_time_remaining_seconds{printer_estimate="slicer",printer_name="mk4"} 19933
+# HELP prusa_job_inaccurate_estimates Returns 1 if the printer reports that time estimates of current print job are inaccurate.
+# TYPE prusa_job_inaccurate_estimates gauge
+prusa_job_inaccurate_estimates{printer_name="mk4"} 1
+# HELP prusa_job_filament_info Returns filament type current print job was sliced for.
+# TYPE prusa_job_filament_info gauge
+prusa_job_filament_info{printer_job_filament="PLA;PLA;PLA;PLA",printer_name="mk4"} 1
+# HELP prusa_job_model_mismatch Returns 1 if current print job was sliced for other printer model than the configured one.
+# TYPE prusa_job_model_mismatch gauge
+prusa_job_model_mismatch{printer_job_sliced_model="XLIS",printer_name="mk4"} 1
+# HELP prusa_job_file_size_bytes Returns size of file of current print job in bytes.
+# TYPE prusa_job_file_size_bytes gauge
+prusa_job_file_size_bytes{printer_name="mk4"} 1.0262918e+07
+# HELP prusa_layer_height_meters Returns layer height of current print in meters.
+# TYPE prusa_layer_height_meters gauge
+prusa_layer_height_meters{printer_name="mk4"} 0.00015
+`
+	err = testutil.CollectAndCompare(jobCollector{c, snap}, strings.NewReader(expected),
+		"prusa_job_id", "prusa_job_time_remaining_seconds", "prusa_job_inaccurate_estimates", "prusa_job_filament_info",
+		"prusa_job_model_mismatch", "prusa_job_file_size_bytes", "prusa_layer_height_meters")
+	if err != nil {
+		t.Error(err)
+	}
+
+	snap.jobV1 = JobV1{} // printer is idle
+	if count := testutil.CollectAndCount(jobCollector{c, snap}); count != 0 {
+		t.Errorf("idle printer: expected no job metrics, got %d", count)
+	}
+}
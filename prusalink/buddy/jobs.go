@@ -0,0 +1,241 @@
+package prusalink
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/pstrobl96/prusa_exporter/config"
+)
+
+const (
+	outcomeFinished  = "finished"
+	outcomeCancelled = "cancelled"
+	outcomeError     = "error"
+	outcomeUnknown   = "unknown" // job disappeared between polls before its end was seen
+)
+
+// Metrics of print jobs of Buddy and Einsy printers, they are kept across polls so finished jobs do not vanish
+// with the job labels. SL printers do not report job id and its state, their jobs are not tracked.
+var (
+	jobsStarted = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "prusa_jobs_started_total",
+			Help: "Number of print jobs started by Buddy and Einsy printers.",
+		},
+		[]string{"printer_address", "printer_model", "printer_name"},
+	)
+	jobsEnded = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "prusa_jobs_ended_total",
+			Help: "Number of print jobs ended by Buddy and Einsy printers by outcome - finished, cancelled, error or unknown.",
+		},
+		[]string{"printer_address", "printer_model", "printer_name", "printer_job_outcome"},
+	)
+	jobDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "prusa_job_duration_seconds",
+			Help:    "Print time of ended print jobs of Buddy and Einsy printers in seconds.",
+			Buckets: []float64{900, 1800, 3600, 7200, 14400, 28800, 43200, 86400, 172800},
+		},
+		[]string{"printer_address", "printer_model", "printer_name", "printer_job_outcome"},
+	)
+	lastJobOutcome = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "prusa_last_job_outcome",
+			Help: "Returns 1 with outcome of the last ended print job.",
+		},
+		[]string{"printer_address", "printer_model", "printer_name", "printer_job_name", "printer_job_outcome"},
+	)
+	lastJobDuration = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "prusa_last_job_duration_seconds",
+			Help: "Returns print time of the last ended print job in seconds.",
+		},
+		[]string{"printer_address", "printer_model", "printer_name"},
+	)
+
+	jobMetrics = []prometheus.Collector{jobsStarted, jobsEnded, jobDuration, lastJobOutcome, lastJobDuration}
+
+	// trackers of jobs by printer address, they outlive pollers which are replaced on reload
+	trackersMu  sync.Mutex
+	trackers    = map[string]*jobTracker{}
+	jobHandlers []func(EndedJob)
+)
+
+// EndedJob describes a print job that has ended, as it was seen by the exporter
+type EndedJob struct {
+	Printer     config.Printers
+	ID          int
+	Name        string
+	DisplayName string
+	Path        string
+	Filament    string
+	SlicedModel string
+	Start       time.Time // estimated from print time when the job was seen first
+	End         time.Time
+	Duration    float64 // print time in seconds
+	Outcome     string
+}
+
+// JobState is the job of a printer as it was seen in a single poll
+type JobState struct {
+	ID          int    // 0 if the printer has no job
+	State       string // state of the job or printer from v1 API, e.g. PRINTING or FINISHED
+	Name        string
+	DisplayName string
+	Path        string
+	Filament    string
+	SlicedModel string
+	PrintTime   float64 // seconds
+}
+
+// jobTracker follows the current job of a printer across polls
+type jobTracker struct {
+	job   EndedJob
+	ended bool
+}
+
+// OnJobEnd registers handler which is called with every ended job
+func OnJobEnd(handler func(EndedJob)) {
+	trackersMu.Lock()
+	defer trackersMu.Unlock()
+	jobHandlers = append(jobHandlers, handler)
+}
+
+// jobOutcome returns outcome of the job from its state reported by v1 API, or empty string while the job runs
+// or the state is missing. Jobs that disappear without a reported end are ended as unknown.
+func jobOutcome(state string) string {
+	switch strings.ToUpper(state) {
+	case "FINISHED":
+		return outcomeFinished
+	case "STOPPED":
+		return outcomeCancelled
+	case "ERROR":
+		return outcomeError
+	}
+	return ""
+}
+
+// trackJob tracks the job of Buddy printer from its snapshot
+func trackJob(snap *snapshot) {
+	if !snap.up {
+		return
+	}
+	job := JobState{
+		ID:          int(snap.jobV1.ID),
+		State:       snap.jobV1.State,
+		Name:        snap.job.Job.File.Name,
+		DisplayName: snap.jobV1.File.DisplayName,
+		Path:        snap.job.Job.File.Path,
+		Filament:    snap.jobV1.File.Meta.FilamentType,
+		SlicedModel: snap.jobV1.File.Meta.PrinterModel,
+		PrintTime:   max(snap.jobV1.TimePrinting, snap.job.Progress.PrintTime),
+	}
+	if job.ID == 0 {
+		job.ID = int(snap.status.Job.ID)
+	}
+	if job.State == "" {
+		job.State = snap.status.Printer.State
+	}
+	TrackJob(snap.printer, snap.time, job)
+}
+
+// TrackJob detects start and end of print jobs of the printer from job id and state in successive polls.
+// Start of a job that was already running when the printer was polled first is not counted.
+func TrackJob(s config.Printers, at time.Time, job JobState) {
+	outcome := jobOutcome(job.State)
+	var ended []EndedJob
+
+	trackersMu.Lock()
+	t, seen := trackers[s.Address]
+	if !seen {
+		t = &jobTracker{}
+		trackers[s.Address] = t
+	}
+
+	switch {
+	case job.ID == 0 && job.Name != "":
+		// job is known only by legacy endpoint, v1 endpoints probably failed
+	case job.ID == 0:
+		if t.job.ID != 0 && !t.ended {
+			ended = append(ended, t.end(s, outcomeUnknown, at))
+		}
+	default:
+		if job.ID != t.job.ID {
+			if t.job.ID != 0 && !t.ended {
+				ended = append(ended, t.end(s, outcomeUnknown, at))
+			}
+			*t = jobTracker{job: EndedJob{ID: job.ID}}
+			if !seen && outcome != "" {
+				t.ended = true // job ended before the printer was polled first
+			} else if seen {
+				jobsStarted.WithLabelValues(s.Address, s.Type, s.Name).Inc()
+			}
+		}
+		if !t.ended {
+			t.update(s, at, job)
+			if outcome != "" {
+				ended = append(ended, t.end(s, outcome, at))
+			}
+		}
+	}
+	handlers := jobHandlers
+	trackersMu.Unlock()
+
+	// handlers may be slow, e.g. writes to the history, so they don't block tracking of other printers
+	for _, job := range ended {
+		for _, handler := range handlers {
+			handler(job)
+		}
+	}
+}
+
+// update remembers details of the job, they are not sent by the printer when the job is gone.
+// Start is estimated from the print time when the job is seen first.
+func (t *jobTracker) update(s config.Printers, at time.Time, state JobState) {
+	job := &t.job
+	job.Printer = s
+	job.Duration = max(state.PrintTime, job.Duration)
+	if job.Start.IsZero() {
+		job.Start = at.Add(-time.Duration(state.PrintTime * float64(time.Second)))
+	}
+	for field, value := range map[*string]string{
+		&job.Name:        state.Name,
+		&job.DisplayName: state.DisplayName,
+		&job.Path:        state.Path,
+		&job.Filament:    state.Filament,
+		&job.SlicedModel: state.SlicedModel,
+	} {
+		if value != "" {
+			*field = value
+		}
+	}
+}
+
+// end records end of the job to metrics and returns copy of the ended job
+func (t *jobTracker) end(s config.Printers, outcome string, end time.Time) EndedJob {
+	t.ended = true
+	t.job.Printer, t.job.Outcome, t.job.End = s, outcome, end
+	jobsEnded.WithLabelValues(s.Address, s.Type, s.Name, outcome).Inc()
+	jobDuration.WithLabelValues(s.Address, s.Type, s.Name, outcome).Observe(t.job.Duration)
+
+	lastJobOutcome.DeletePartialMatch(prometheus.Labels{"printer_address": s.Address})
+	lastJobOutcome.WithLabelValues(s.Address, s.Type, s.Name, t.job.Name, outcome).Set(1)
+	lastJobDuration.WithLabelValues(s.Address, s.Type, s.Name).Set(t.job.Duration)
+	return t.job
+}
+
+// ForgetJobs removes job metrics and tracker of the printer, it is called when the printer is removed from configuration
+func ForgetJobs(printer config.Printers) {
+	trackersMu.Lock()
+	delete(trackers, printer.Address)
+	trackersMu.Unlock()
+
+	for _, metric := range []interface {
+		DeletePartialMatch(prometheus.Labels) int
+	}{jobsStarted, jobsEnded, jobDuration, lastJobOutcome, lastJobDuration} {
+		metric.DeletePartialMatch(prometheus.Labels{"printer_address": printer.Address})
+	}
+}
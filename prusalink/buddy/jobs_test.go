@@ -0,0 +1,102 @@
+package prusalink
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/pstrobl96/prusa_exporter/config"
+)
+
+func TestTrackJob(t *testing.T) {
+	printer := config.Printers{Address: "10.0.0.5", Name: "mk4", Type: "MK4"}
+	t.Cleanup(func() { ForgetJobs(printer) })
+	var ended []EndedJob
+	OnJobEnd(func(job EndedJob) { ended = append(ended, job) })
+
+	poll := func(id float64, state string, printing float64) {
+		snap := &snapshot{printer: printer, up: true, time: time.Unix(10000, 0)}
+		snap.jobV1.ID, snap.jobV1.State, snap.jobV1.TimePrinting = id, state, printing
+		if id != 0 {
+			snap.job.Job.File.Name = "BENCHY.BGC"
+		}
+		trackJob(snap)
+	}
+
+	poll(41, "FINISHED", 3000) // ended before the exporter started
+	poll(0, "", 0)
+	poll(42, "PRINTING", 10)
+	poll(42, "PAUSED", 500)
+	poll(42, "FINISHED", 3600)
+	poll(42, "FINISHED", 3600)
+	poll(43, "PRINTING", 60)
+	poll(43, "STOPPED", 120)
+	poll(44, "PRINTING", 30)
+	poll(45, "PRINTING", 20) // 44 ended between polls
+	poll(45, "ERROR", 400)
+
+	type testCase struct {
+		Outcome string
+		Count   float64
+	}
+	cases := []testCase{
+		{outcomeFinished, 1},
+		{outcomeCancelled, 1},
+		{outcomeError, 1},
+		{outcomeUnknown, 1},
+	}
+	for _, tc := range cases {
+		if got := testutil.ToFloat64(jobsEnded.WithLabelValues(printer.Address, printer.Type, printer.Name, tc.Outcome)); got != tc.Count {
+			t.Errorf("%s: got %v jobs, want %v", tc.Outcome, got, tc.Count)
+		}
+	}
+	if got := testutil.ToFloat64(jobsStarted.WithLabelValues(printer.Address, printer.Type, printer.Name)); got != 4 {
+		t.Errorf("started: got %v jobs, want 4", got)
+	}
+	if got := testutil.ToFloat64(lastJobDuration.WithLabelValues(printer.Address, printer.Type, printer.Name)); got != 400 {
+		t.Errorf("last duration: got %v, want 400", got)
+	}
+	if got := testutil.ToFloat64(lastJobOutcome.WithLabelValues(printer.Address, printer.Type, printer.Name, "BENCHY.BGC", outcomeError)); got != 1 {
+		t.Errorf("last outcome: got %v, want 1", got)
+	}
+	if count := testutil.CollectAndCount(lastJobOutcome); count != 1 {
+		t.Errorf("last outcome: got %d series, want 1", count)
+	}
+	if count := testutil.CollectAndCount(jobDuration); count != 4 {
+		t.Errorf("duration: got %d histograms, want 4", count)
+	}
+
+	if len(ended) != 4 || ended[0].ID != 42 || ended[0].Outcome != outcomeFinished || ended[0].Duration != 3600 ||
+		ended[0].Name != "BENCHY.BGC" || !ended[0].Start.Equal(time.Unix(10000-10, 0)) {
+		t.Errorf("unexpected ended jobs %+v", ended)
+	}
+}
+
+func TestTrackJobRunningWhenPolledFirst(t *testing.T) {
+	printer := config.Printers{Address: "10.0.0.7", Name: "mk3s", Type: "I3MK3S"}
+	t.Cleanup(func() { ForgetJobs(printer) })
+
+	at := time.Unix(20000, 0)
+	TrackJob(printer, at, JobState{ID: 7, State: "PRINTING", Name: "CUBE.GCO", PrintTime: 600})
+	if got := testutil.ToFloat64(jobsStarted.WithLabelValues(printer.Address, printer.Type, printer.Name)); got != 0 {
+		t.Errorf("started: got %v jobs, want 0 for job that was running before the first poll", got)
+	}
+
+	TrackJob(printer, at.Add(time.Minute), JobState{ID: 7, State: "FINISHED", Name: "CUBE.GCO", PrintTime: 660})
+	if got := testutil.ToFloat64(jobsEnded.WithLabelValues(printer.Address, printer.Type, printer.Name, outcomeFinished)); got != 1 {
+		t.Errorf("finished: got %v jobs, want 1", got)
+	}
+	if got := testutil.ToFloat64(lastJobDuration.WithLabelValues(printer.Address, printer.Type, printer.Name)); got != 660 {
+		t.Errorf("last duration: got %v, want 660", got)
+	}
+
+	// state is missing, job is ended as unknown only when it disappears
+	TrackJob(printer, at.Add(2*time.Minute), JobState{ID: 8, Name: "CUBE.GCO", PrintTime: 10})
+	TrackJob(printer, at.Add(3*time.Minute), JobState{})
+	if got := testutil.ToFloat64(jobsStarted.WithLabelValues(printer.Address, printer.Type, printer.Name)); got != 1 {
+		t.Errorf("started: got %v jobs, want 1", got)
+	}
+	if got := testutil.ToFloat64(jobsEnded.WithLabelValues(printer.Address, printer.Type, printer.Name, outcomeUnknown)); got != 1 {
+		t.Errorf("unknown: got %v jobs, want 1", got)
+	}
+}
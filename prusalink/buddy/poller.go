@@ -0,0 +1,219 @@
+package prusalink
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pstrobl96/prusa_exporter/config"
+	"github.com/rs/zerolog/log"
+)
+
+// defaultPollInterval is used when prusalink.poll_interval is not set
+const defaultPollInterval = 10 * time.Second
+
+// PollInterval returns how often printers are polled with the given configuration
+func PollInterval(config config.Config) time.Duration {
+	if config.PrusaLink.PollInterval > 0 {
+		return time.Duration(config.PrusaLink.PollInterval) * time.Second
+	}
+	return defaultPollInterval
+}
+
+// snapshot is the data fetched from a printer in one poll
+type snapshot struct {
+	printer config.Printers
+	time    time.Time
+	up      bool
+
+	job         Job
+	jobV1       JobV1 // empty if the printer is not printing
+	printerData Printer
+	version     Version
+	status      Status
+	info        Info
+	storage     StorageV1     // refreshed on the files interval
+	cameras     Cameras       // refreshed on the files interval
+	files       fileInventory // nil until files are listed
+	thumbnail   *thumbnail
+}
+
+// thumbnail is the image of a print job, served at /printers/{name}/thumbnail.png
+type thumbnail struct {
+	path string // path of the job file
+	png  []byte
+	hash string
+}
+
+func newThumbnail(path string, png []byte) *thumbnail {
+	sum := sha256.Sum256(png)
+	return &thumbnail{
+		path: path,
+		png:  png,
+		hash: hex.EncodeToString(sum[:8]),
+	}
+}
+
+// fetchSnapshot queries PrusaLink endpoints of the printer that change while it prints,
+// storage and cameras are fetched by fetchInventory. The snapshot is returned as down
+// if one of the essential endpoints fails.
+// Thumbnail is downloaded only if withImage is set and the cached one belongs to another job.
+func fetchSnapshot(s config.Printers, withImage bool, cached *thumbnail) *snapshot {
+	var err error
+	snap := &snapshot{printer: s}
+	start := time.Now()
+	defer func() {
+		snap.time = time.Now()
+		ObserveScrape(s, start, snap.up)
+	}()
+
+	log.Debug().Msg("Printer scraping at " + s.Address)
+
+	snap.job, err = GetJob(s)
+	if err != nil {
+		log.Error().Msg("Error while scraping job endpoint at " + s.Address + " - " + err.Error())
+		return snap
+	}
+
+	snap.printerData, err = GetPrinter(s)
+	if err != nil {
+		log.Error().Msg("Error while scraping printer endpoint at " + s.Address + " - " + err.Error())
+		return snap
+	}
+
+	snap.version, err = GetVersion(s)
+	if err != nil {
+		log.Error().Msg("Error while scraping version endpoint at " + s.Address + " - " + err.Error())
+		return snap
+	}
+
+	snap.status, err = GetStatus(s)
+
+	if err != nil {
+		log.Error().Msg("Error while scraping status endpoint at " + s.Address + " - " + err.Error())
+	}
+
+	snap.info, err = GetInfo(s)
+
+	if err != nil {
+		log.Error().Msg("Error while scraping info endpoint at " + s.Address + " - " + err.Error())
+	}
+
+	// v1 job is asked for only when there is a job
+	if snap.job.Job.File.Path != "" {
+		snap.jobV1, err = GetJobV1(s)
+
+		if err != nil {
+			log.Error().Msg("Error while scraping v1 job endpoint at " + s.Address + " - " + err.Error())
+		}
+	}
+
+	if withImage && GetStateFlag(snap.printerData) == 4 {
+		path := snap.job.Job.File.Path
+		if cached != nil && cached.path == path {
+			snap.thumbnail = cached
+		} else if image, err := GetJobThumbnail(s, path); err != nil {
+			log.Error().Msg("Error while scraping image endpoint at " + s.Address + " - " + err.Error())
+		} else {
+			snap.thumbnail = newThumbnail(path, image)
+		}
+	}
+
+	snap.up = true
+	log.Debug().Msg("Scraping done at " + s.Address)
+
+	return snap
+}
+
+// fetchInventory queries storage and cameras of the printer, they rarely change.
+// Values are left untouched if the endpoint fails.
+func fetchInventory(s config.Printers, storage *StorageV1, cameras *Cameras) {
+	if result, err := GetStorageV1(s); err != nil {
+		log.Error().Msg("Error while scraping storage endpoint at " + s.Address + " - " + err.Error())
+	} else {
+		*storage = result
+	}
+
+	if result, err := GetCameras(s); err != nil {
+		log.Error().Msg("Error while scraping cameras endpoint at " + s.Address + " - " + err.Error())
+	} else {
+		*cameras = result
+	}
+}
+
+// poller refreshes the snapshot of a single printer on its own interval.
+// Files, storage and cameras are refreshed on a slower filesInterval.
+type poller struct {
+	printer       config.Printers
+	interval      time.Duration
+	filesInterval time.Duration
+
+	fetchImage atomic.Bool
+
+	mu   sync.RWMutex
+	last *snapshot
+
+	stop chan struct{}
+}
+
+func newPoller(printer config.Printers, interval time.Duration, filesInterval time.Duration) *poller {
+	return &poller{
+		printer:       printer,
+		interval:      interval,
+		filesInterval: filesInterval,
+		stop:          make(chan struct{}),
+	}
+}
+
+func (p *poller) run() {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	var cached *thumbnail
+	var files fileInventory
+	var storage StorageV1
+	var cameras Cameras
+	var filesListed time.Time
+	for {
+		snap := fetchSnapshot(p.printer, p.fetchImage.Load(), cached)
+		if snap.thumbnail != nil {
+			cached = snap.thumbnail
+		}
+
+		if snap.up && time.Since(filesListed) >= p.filesInterval {
+			filesListed = time.Now() // failed listing is not retried sooner, it's expensive
+			fetchInventory(p.printer, &storage, &cameras)
+			if list, err := GetFiles(p.printer); err != nil {
+				log.Error().Msg("Error while scraping files endpoint at " + p.printer.Address + " - " + err.Error())
+			} else {
+				files = newFileInventory(list)
+			}
+		}
+		snap.files, snap.storage, snap.cameras = files, storage, cameras
+		trackJob(snap)
+
+		p.mu.Lock()
+		p.last = snap
+		p.mu.Unlock()
+
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// snapshot returns the latest snapshot or nil if the printer was not polled yet
+func (p *poller) snapshot() *snapshot {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.last
+}
+
+// close stops the poller. It does not wait for a poll in progress.
+func (p *poller) close() {
+	close(p.stop)
+}
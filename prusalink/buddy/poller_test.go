@@ -0,0 +1,89 @@
+package prusalink
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pstrobl96/prusa_exporter/config"
+)
+
+func TestPollerRequests(t *testing.T) {
+	printing, err := os.ReadFile("../api/buddy/job.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	printer, err := os.ReadFile("../api/buddy/printer.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		Name   string
+		Job    []byte
+		Active bool // v1 job is requested in every poll
+	}{
+		{"printing", printing, true},
+		{"idle", []byte(`{"state": "Operational"}`), false},
+	} {
+		var mu sync.Mutex
+		requests := map[string]int{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			requests[r.URL.Path]++
+			mu.Unlock()
+			switch r.URL.Path {
+			case "/api/job":
+				w.Write(tc.Job)
+			case "/api/printer":
+				w.Write(printer)
+			case "/api/version":
+				w.Write([]byte(`{"api": "2.0.0"}`))
+			default:
+				w.WriteHeader(http.StatusNoContent)
+			}
+		}))
+
+		p := newPoller(config.Printers{Address: strings.TrimPrefix(server.URL, "http://"), Name: "mk4", Type: "MK4"},
+			time.Millisecond, time.Hour)
+		done := make(chan struct{})
+		go func() {
+			p.run()
+			close(done)
+		}()
+
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			mu.Lock()
+			polls := requests["/api/job"]
+			mu.Unlock()
+			if polls >= 3 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("%s: printer was not polled", tc.Name)
+			}
+			time.Sleep(time.Millisecond)
+		}
+		p.close()
+		<-done
+		server.Close()
+		ForgetPrinter(p.printer)
+
+		polls := requests["/api/job"]
+		// storage, cameras and files are refreshed on the files interval only
+		expected := map[string]int{"/api/v1/storage": 1, "/api/v1/cameras": 1, "/api/files": 1, "/api/v1/job": 0}
+		if tc.Active {
+			expected["/api/v1/job"] = polls
+		}
+		for path, count := range expected {
+			if requests[path] != count {
+				t.Errorf("%s: %s requested %d times in %d polls, want %d", tc.Name, path, requests[path], polls, count)
+			}
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package prusalink
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/pstrobl96/prusa_exporter/config"
+)
+
+// probeCollector collects metrics of a single printer at scrape time
+type probeCollector struct {
+	collector *Collector
+	printer   config.Printers
+}
+
+// Describe implements prometheus.Collector. Probe metrics are unchecked.
+func (p probeCollector) Describe(ch chan<- *prometheus.Desc) {}
+
+// Collect implements prometheus.Collector
+func (p probeCollector) Collect(ch chan<- prometheus.Metric) {
+	// Thumbnails are served only for configured printers
+	snap := fetchSnapshot(p.printer, false, nil)
+	if snap.up {
+		fetchInventory(p.printer, &snap.storage, &snap.cameras)
+	}
+
+	p.collector.mu.RLock()
+	defer p.collector.mu.RUnlock()
+	p.collector.collectSnapshot(ch, snap)
+}
+
+// ServeProbe handles /probe?target=<address>&module=<name> requests in the style of blackbox_exporter.
+// Credentials and printer type are taken from the named module in the configuration file, module default is used
+// when the module is not set.
+func (c *Collector) ServeProbe(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	target := params.Get("target")
+	if target == "" {
+		http.Error(w, "Target parameter is missing", http.StatusBadRequest)
+		return
+	}
+
+	moduleName := params.Get("module")
+	if moduleName == "" {
+		moduleName = "default"
+	}
+
+	c.mu.RLock()
+	module, ok := c.configuration.Modules[moduleName]
+	c.mu.RUnlock()
+
+	if !ok {
+		http.Error(w, "Unknown module "+moduleName, http.StatusBadRequest)
+		return
+	}
+
+	printer := config.Printers{
+		Address:  target,
+		Username: module.Username,
+		Password: module.Password,
+		Apikey:   module.Apikey,
+		Name:     params.Get("name"),
+		Type:     module.Type,
+		Probe:    true,
+	}
+
+	if printerType := params.Get("type"); printerType != "" {
+		printer.Type = printerType
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(probeCollector{collector: c, printer: printer})
+
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
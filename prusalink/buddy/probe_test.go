@@ -0,0 +1,69 @@
+package prusalink
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/pstrobl96/prusa_exporter/config"
+)
+
+func TestServeProbe(t *testing.T) {
+	fixtures := map[string]string{"/api/job": "job.json", "/api/printer": "printer.json", "/api/version": "version.json"}
+	printer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fixture, ok := fixtures[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		data, err := os.ReadFile("../api/buddy/" + fixture)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write(data)
+	}))
+	defer printer.Close()
+	target := strings.TrimPrefix(printer.URL, "http://")
+
+	var cfg config.Config
+	cfg.Modules = map[string]config.Module{"mk4": {Apikey: "key", Type: "MK4"}}
+	c := NewCollector(cfg)
+
+	type testCase struct {
+		Query string
+		Code  int
+	}
+	cases := []testCase{
+		{"", http.StatusBadRequest},
+		{"?target=" + target + "&module=xl", http.StatusBadRequest},
+		{"?target=" + target, http.StatusBadRequest}, // module default is not configured
+		{"?target=" + target + "&module=mk4&name=probed", http.StatusOK},
+	}
+	for _, tc := range cases {
+		rec := httptest.NewRecorder()
+		c.ServeProbe(rec, httptest.NewRequest("GET", "/probe"+tc.Query, nil))
+		if rec.Code != tc.Code {
+			t.Errorf("%q: got %d, want %d", tc.Query, rec.Code, tc.Code)
+			continue
+		}
+		if tc.Code == http.StatusOK {
+			expected := `prusa_up{printer_address="` + target + `",printer_model="MK4",printer_name="probed"} 1`
+			if body := rec.Body.String(); !strings.Contains(body, expected) {
+				t.Errorf("%q: expected %s in\n%s", tc.Query, expected, body)
+			}
+		}
+	}
+
+	// nothing would remove exporter metrics of probed targets
+	for name, metric := range map[string]interface {
+		DeletePartialMatch(prometheus.Labels) int
+	}{"requests": requestsTotal, "request duration": requestDuration, "last success": lastSuccess, "scrape duration": scrapeDuration} {
+		if count := metric.DeletePartialMatch(prometheus.Labels{"printer_address": target}); count != 0 {
+			t.Errorf("%s: got %d series of probed target, want 0", name, count)
+		}
+	}
+}
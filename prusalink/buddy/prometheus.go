@@ -1,44 +1,71 @@
 package prusalink
 
 import (
+	"slices"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/pstrobl96/prusa_exporter/config"
-	"github.com/rs/zerolog/log"
 )
 
 // Collector is a struct of all printer metrics
 type Collector struct {
+	mu sync.RWMutex
+
 	metricDesc     map[MetricName]*prometheus.Desc
 	metricDisabled map[MetricName]bool
 
 	configuration config.Config
 	commonLabels  []string
+
+	pollers map[string]*poller
 }
 
 type MetricName string
 
 const (
-	MetricPrinterTemp               MetricName = "prusa_temperature_celsius"
-	MetricPrinterTempTarget                    = "prusa_temperature_target_celsius"
-	MetricPrinterPrintTimeRemaining            = "prusa_printing_time_remaining_seconds"
-	MetricPrinterPrintProgressRatio            = "prusa_printing_progress_ratio"
-	MetricPrinterFiles                         = "prusa_files_count"
-	MetricPrinterMaterial                      = "prusa_material_info"
-	MetricPrinterPrintTime                     = "prusa_print_time_seconds"
-	MetricPrinterUp                            = "prusa_up"
-	MetricPrinterNozzleSize                    = "prusa_nozzle_size_meters"
-	MetricPrinterStatus                        = "prusa_status_info"
-	MetricPrinterAxis                          = "prusa_axis"
-	MetricPrinterFlow                          = "prusa_print_flow_ratio"
-	MetricPrinterInfo                          = "prusa_info"
-	MetricPrinterMMU                           = "prusa_mmu"
-	MetricPrinterFanSpeedRpm                   = "prusa_fan_speed_rpm"
-	MetricPrinterPrintSpeedRatio               = "prusa_print_speed_ratio"
-	MetricPrinterJobImage                      = "prusa_job_image"
-	MetricPrinterCurrentJob                    = "prusa_job"
+	MetricPrinterTemp                   MetricName = "prusa_temperature_celsius"
+	MetricPrinterTempTarget                        = "prusa_temperature_target_celsius"
+	MetricPrinterPrintTimeRemaining                = "prusa_printing_time_remaining_seconds"
+	MetricPrinterPrintProgressRatio                = "prusa_printing_progress_ratio"
+	MetricPrinterFiles                             = "prusa_files_count"
+	MetricPrinterMaterial                          = "prusa_material_info"
+	MetricPrinterPrintTime                         = "prusa_print_time_seconds"
+	MetricPrinterUp                                = "prusa_up"
+	MetricPrinterNozzleSize                        = "prusa_nozzle_size_meters"
+	MetricPrinterStatus                            = "prusa_status_info"
+	MetricPrinterAxis                              = "prusa_axis"
+	MetricPrinterFlow                              = "prusa_print_flow_ratio"
+	MetricPrinterInfo                              = "prusa_info"
+	MetricPrinterMMU                               = "prusa_mmu"
+	MetricPrinterFanSpeedRpm                       = "prusa_fan_speed_rpm"
+	MetricPrinterPrintSpeedRatio                   = "prusa_print_speed_ratio"
+	MetricPrinterJobImage                          = "prusa_job_image"
+	MetricPrinterCurrentJob                        = "prusa_job"
+	MetricPrinterSnapshotAge                       = "prusa_snapshot_age_seconds"
+	MetricPrinterStorageFree                       = "prusa_storage_free_bytes"
+	MetricPrinterStorageTotal                      = "prusa_storage_total_bytes"
+	MetricPrinterStorageAvailable                  = "prusa_storage_available"
+	MetricPrinterStorageReadOnly                   = "prusa_storage_read_only"
+	MetricPrinterStoragePrintFiles                 = "prusa_storage_print_files_bytes"
+	MetricPrinterStorageSystemFiles                = "prusa_storage_system_files_bytes"
+	MetricPrinterFilesSize                         = "prusa_files_size_bytes"
+	MetricPrinterFilesNewest                       = "prusa_files_newest_timestamp_seconds"
+	MetricPrinterCamera                            = "prusa_camera_info"
+	MetricPrinterCameraConnected                   = "prusa_camera_connected"
+	MetricPrinterCameraDetected                    = "prusa_camera_detected"
+	MetricPrinterCameraRegistered                  = "prusa_camera_registered"
+	MetricPrinterJobID                             = "prusa_job_id"
+	MetricPrinterJobEstimatedPrintTime             = "prusa_job_estimated_print_time_seconds"
+	MetricPrinterJobTimeRemaining                  = "prusa_job_time_remaining_seconds"
+	MetricPrinterJobInaccurateEstimates            = "prusa_job_inaccurate_estimates"
+	MetricPrinterJobFilament                       = "prusa_job_filament_info"
+	MetricPrinterJobSlicedModel                    = "prusa_job_sliced_model_info"
+	MetricPrinterJobModelMismatch                  = "prusa_job_model_mismatch"
+	MetricPrinterJobFileSize                       = "prusa_job_file_size_bytes"
+	MetricPrinterLayerHeight                       = "prusa_layer_height_meters"
 )
 
 type metricDesc struct {
@@ -52,7 +79,19 @@ var metrics = []metricDesc{
 	{MetricPrinterTempTarget, "Target temp of printer in Celsius", []string{"printer_heated_element"}},
 	{MetricPrinterPrintTimeRemaining, "Returns time that remains for completion of current print", nil},
 	{MetricPrinterPrintProgressRatio, "Returns information about completion of current print in ratio (0.0-1.0)", nil},
-	{MetricPrinterFiles, "Number of files in storage", []string{"printer_storage"}},
+	{MetricPrinterFiles, "Number of files in storage by extension", []string{"printer_storage", "printer_file_extension"}},
+	{MetricPrinterFilesSize, "Returns total size of files in storage in bytes.", []string{"printer_storage"}},
+	{MetricPrinterFilesNewest, "Returns upload time of the newest file in storage as unix timestamp.", []string{"printer_storage"}},
+	{MetricPrinterCamera, "Returns information about camera of the printer, its snapshot is served by the exporter.", []string{"printer_camera_id", "printer_camera_name", "printer_camera_driver", "printer_camera_resolution", "printer_camera_trigger_scheme", "printer_camera_snapshot"}},
+	{MetricPrinterCameraConnected, "Returns 1 if the camera is connected.", []string{"printer_camera_id"}},
+	{MetricPrinterCameraDetected, "Returns 1 if the camera is detected by the printer.", []string{"printer_camera_id"}},
+	{MetricPrinterCameraRegistered, "Returns 1 if the camera is registered to Prusa Connect.", []string{"printer_camera_id"}},
+	{MetricPrinterStorageFree, "Returns free space of the storage in bytes.", []string{"printer_storage"}},
+	{MetricPrinterStorageTotal, "Returns total space of the storage in bytes.", []string{"printer_storage"}},
+	{MetricPrinterStorageAvailable, "Returns 1 if the storage is available.", []string{"printer_storage"}},
+	{MetricPrinterStorageReadOnly, "Returns 1 if the storage is read only.", []string{"printer_storage"}},
+	{MetricPrinterStoragePrintFiles, "Returns size of print files in the storage in bytes.", []string{"printer_storage"}},
+	{MetricPrinterStorageSystemFiles, "Returns size of system files in the storage in bytes.", []string{"printer_storage"}},
 	{MetricPrinterMaterial, "Returns information about loaded filament. Returns 0 if there is no loaded filament", []string{"printer_filament"}},
 	{MetricPrinterPrintTime, "Returns information about current print time.", nil},
 	{MetricPrinterNozzleSize, "Returns information about selected nozzle size.", nil},
@@ -63,7 +102,16 @@ var metrics = []metricDesc{
 	{MetricPrinterMMU, "Returns information if MMU is enabled.", nil},
 	{MetricPrinterFanSpeedRpm, "Returns information about speed of hotend fan in rpm.", []string{"fan"}},
 	{MetricPrinterPrintSpeedRatio, "Current setting of printer speed in values from 0.0 - 1.0", nil},
-	{MetricPrinterJobImage, "Returns information about image of current print job.", []string{"printer_job_image"}},
+	{MetricPrinterJobID, "Returns ID of current print job.", nil},
+	{MetricPrinterJobEstimatedPrintTime, "Returns print time of current print job estimated by the slicer in seconds.", nil},
+	{MetricPrinterJobTimeRemaining, "Returns time that remains for completion of current print job in seconds, as estimated by the printer or by the slicer.", []string{"printer_estimate"}},
+	{MetricPrinterJobInaccurateEstimates, "Returns 1 if the printer reports that time estimates of current print job are inaccurate.", nil},
+	{MetricPrinterJobFilament, "Returns filament type current print job was sliced for.", []string{"printer_job_filament"}},
+	{MetricPrinterJobSlicedModel, "Returns printer model current print job was sliced for.", []string{"printer_job_sliced_model"}},
+	{MetricPrinterJobModelMismatch, "Returns 1 if current print job was sliced for other printer model than the configured one.", []string{"printer_job_sliced_model"}},
+	{MetricPrinterJobFileSize, "Returns size of file of current print job in bytes.", nil},
+	{MetricPrinterLayerHeight, "Returns layer height of current print in meters.", nil},
+	{MetricPrinterJobImage, "Returns URL of image of current print job served by the exporter.", []string{"printer_job_image"}},
 }
 
 // Unlike `metrics`, these ignore common labels.
@@ -71,6 +119,24 @@ var specialMetrics = []metricDesc{
 	{MetricPrinterUp, "Return information about online printers. If printer is registered as offline then returned value is 0.", []string{"printer_address", "printer_model", "printer_name"}},
 
 	{MetricPrinterCurrentJob, "Returns information about the current print job.", []string{"printer_address", "printer_model", "printer_name", "printer_job_name", "printer_job_path"}},
+
+	{MetricPrinterSnapshotAge, "Returns age of the cached PrusaLink data in seconds.", []string{"printer_address", "printer_model", "printer_name"}},
+}
+
+// NewDesc returns descriptor of the named metric, so collectors of other boards
+// expose metrics of the same name with the same help and labels.
+func NewDesc(name MetricName, commonLabels []string) *prometheus.Desc {
+	for _, m := range metrics {
+		if m.Name == name {
+			return prometheus.NewDesc(string(m.Name), m.Description, slices.Concat(commonLabels, m.Labels), nil)
+		}
+	}
+	for _, m := range specialMetrics {
+		if m.Name == name {
+			return prometheus.NewDesc(string(m.Name), m.Description, m.Labels, nil)
+		}
+	}
+	return nil
 }
 
 func (c *Collector) metricEnabled(m MetricName) bool {
@@ -80,29 +146,74 @@ func (c *Collector) metricEnabled(m MetricName) bool {
 
 // NewCollector returns a new Collector for printer metrics
 func NewCollector(config config.Config) *Collector {
-	configuration = config
+	c := &Collector{}
+	c.apply(config)
+	return c
+}
+
+// Reload swaps the printer list, common labels and disabled metrics of the collector.
+// Scrapes in progress finish with the previous configuration.
+func (c *Collector) Reload(config config.Config) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.apply(config)
+}
+
+func (c *Collector) apply(config config.Config) {
+	setConfiguration(config)
 	commonLabels := config.PrusaLink.CommonLabels
 	if len(commonLabels) == 0 {
 		commonLabels = []string{"printer_address", "printer_model", "printer_name", "printer_job_name", "printer_job_path"}
 	}
-	c := &Collector{
-		configuration:  config,
-		commonLabels:   commonLabels,
-		metricDesc:     map[MetricName]*prometheus.Desc{},
-		metricDisabled: map[MetricName]bool{},
-	}
+	c.configuration = config
+	c.commonLabels = commonLabels
+	c.metricDesc = map[MetricName]*prometheus.Desc{}
+	c.metricDisabled = map[MetricName]bool{}
 
 	for _, m := range metrics {
-		c.metricDesc[m.Name] = prometheus.NewDesc(string(m.Name), m.Description, append(commonLabels, m.Labels...), nil)
+		c.metricDesc[m.Name] = NewDesc(m.Name, commonLabels)
 	}
 	for _, m := range specialMetrics {
-		c.metricDesc[m.Name] = prometheus.NewDesc(string(m.Name), m.Description, m.Labels, nil)
+		c.metricDesc[m.Name] = NewDesc(m.Name, commonLabels)
 	}
 
 	for _, m := range config.PrusaLink.DisableMetrics {
 		c.metricDisabled[MetricName(m)] = true
 	}
-	return c
+
+	c.updatePollers(config)
+}
+
+// updatePollers starts pollers for new or changed printers and stops pollers of removed ones
+func (c *Collector) updatePollers(config config.Config) {
+	interval := PollInterval(config)
+	filesInterval := FilesInterval(config)
+
+	pollers := make(map[string]*poller, len(config.Printers))
+	for _, printer := range config.Printers {
+		if printer.GetBoard() != "buddy" {
+			continue
+		}
+		if p, ok := c.pollers[printer.Address]; ok && p.printer == printer && p.interval == interval && p.filesInterval == filesInterval {
+			p.fetchImage.Store(c.metricEnabled(MetricPrinterJobImage))
+			pollers[printer.Address] = p
+			delete(c.pollers, printer.Address)
+			continue
+		}
+		p := newPoller(printer, interval, filesInterval)
+		p.fetchImage.Store(c.metricEnabled(MetricPrinterJobImage))
+		pollers[printer.Address] = p
+		go p.run()
+	}
+
+	for _, p := range c.pollers {
+		p.close()
+		ForgetPrinter(p.printer)
+		if _, ok := pollers[p.printer.Address]; !ok {
+			ForgetJobs(p.printer) // jobs of reconfigured printer are tracked further
+		}
+	}
+	c.pollers = pollers
 }
 
 // Describe implements prometheus.Collector
@@ -112,230 +223,283 @@ func (collector *Collector) Describe(ch chan<- *prometheus.Desc) {
 	for _, m := range metrics {
 		ch <- collector.metricDesc[m.Name]
 	}
+	for _, m := range selfMetrics {
+		m.Describe(ch)
+	}
+	for _, m := range jobMetrics {
+		m.Describe(ch)
+	}
 }
 
 // Collect implements prometheus.Collector
 func (c *Collector) Collect(ch chan<- prometheus.Metric) {
-	var wg sync.WaitGroup
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	// metrics of the exporter itself cover printers of all boards
+	for _, m := range selfMetrics {
+		m.Collect(ch)
+	}
+	for _, m := range jobMetrics {
+		m.Collect(ch)
+	}
+
 	for _, s := range c.configuration.Printers {
-		wg.Add(1)
-		go func(s config.Printers) {
-			defer wg.Done()
+		if s.GetBoard() != "buddy" {
+			continue // collected by the collector of its board
+		}
 
-			log.Debug().Msg("Printer scraping at " + s.Address)
-			printerUp := prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterUp], prometheus.GaugeValue,
+		var snap *snapshot
+		if p, ok := c.pollers[s.Address]; ok {
+			snap = p.snapshot()
+		}
+
+		if snap == nil {
+			ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterUp], prometheus.GaugeValue,
 				0, s.Address, s.Type, s.Name)
+			continue
+		}
 
-			job, err := GetJob(s)
-			if err != nil {
-				log.Error().Msg("Error while scraping job endpoint at " + s.Address + " - " + err.Error())
-				ch <- printerUp
-				return
-			}
+		c.collectSnapshot(ch, snap)
+	}
+}
 
-			printer, err := GetPrinter(s)
-			if err != nil {
-				log.Error().Msg("Error while scraping printer endpoint at " + s.Address + " - " + err.Error())
-				ch <- printerUp
-				return
-			}
+// collectSnapshot sends metrics of a single printer snapshot
+func (c *Collector) collectSnapshot(ch chan<- prometheus.Metric, snap *snapshot) {
+	s := snap.printer
+	job, printer, version, status, info := snap.job, snap.printerData, snap.version, snap.status, snap.info
 
-			version, err := GetVersion(s)
-			if err != nil {
-				log.Error().Msg("Error while scraping version endpoint at " + s.Address + " - " + err.Error())
-				ch <- printerUp
-				return
-			}
+	if c.metricEnabled(MetricPrinterSnapshotAge) {
+		ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterSnapshotAge], prometheus.GaugeValue,
+			time.Since(snap.time).Seconds(), s.Address, s.Type, s.Name)
+	}
 
-			status, err := GetStatus(s)
+	if !snap.up {
+		ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterUp], prometheus.GaugeValue,
+			0, s.Address, s.Type, s.Name)
+		return
+	}
 
-			if err != nil {
-				log.Error().Msg("Error while scraping status endpoint at " + s.Address + " - " + err.Error())
-			}
+	if c.metricEnabled(MetricPrinterInfo) {
+		printerInfo := prometheus.MustNewConstMetric(
+			c.metricDesc[MetricPrinterInfo], prometheus.GaugeValue,
+			1,
+			c.GetLabels(s, job, version.API, version.Server, version.Text, info.Name, info.Location, info.Serial, info.Hostname)...)
 
-			info, err := GetInfo(s)
+		ch <- printerInfo
+	}
 
-			if err != nil {
-				log.Error().Msg("Error while scraping info endpoint at " + s.Address + " - " + err.Error())
-			}
+	if c.metricEnabled(MetricPrinterCurrentJob) {
+		value := float64(1)
+		if job.Job.File.Name == "" {
+			value = 0
+		}
+		jobInfo := prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterCurrentJob], prometheus.GaugeValue,
+			value,
+			s.Address, s.Type, s.Name, job.Job.File.Name, job.Job.File.Path)
 
-			if c.metricEnabled(MetricPrinterInfo) {
-				printerInfo := prometheus.MustNewConstMetric(
-					c.metricDesc[MetricPrinterInfo], prometheus.GaugeValue,
-					1,
-					c.GetLabels(s, job, version.API, version.Server, version.Text, info.Name, info.Location, info.Serial, info.Hostname)...)
+		ch <- jobInfo
+	}
 
-				ch <- printerInfo
-			}
+	if c.metricEnabled(MetricPrinterFanSpeedRpm) {
+		printerFanHotend := prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterFanSpeedRpm], prometheus.GaugeValue,
+			status.Printer.FanHotend, c.GetLabels(s, job, "hotend")...)
 
-			if c.metricEnabled(MetricPrinterCurrentJob) {
-				value := float64(1)
-				if job.Job.File.Name == "" {
-					value = 0
-				}
-				jobInfo := prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterCurrentJob], prometheus.GaugeValue,
-					value,
-					s.Address, s.Type, s.Name, job.Job.File.Name, job.Job.File.Path)
+		ch <- printerFanHotend
 
-				ch <- jobInfo
-			}
+		printerFanPrint := prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterFanSpeedRpm], prometheus.GaugeValue,
+			status.Printer.FanPrint, c.GetLabels(s, job, "print")...)
 
-			if c.metricEnabled(MetricPrinterFanSpeedRpm) {
-				printerFanHotend := prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterFanSpeedRpm], prometheus.GaugeValue,
-					status.Printer.FanHotend, c.GetLabels(s, job, "hotend")...)
+		ch <- printerFanPrint
+	}
 
-				ch <- printerFanHotend
+	if c.metricEnabled(MetricPrinterNozzleSize) {
+		printerNozzleSize := prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterNozzleSize], prometheus.GaugeValue,
+			info.NozzleDiameter, c.GetLabels(s, job)...)
 
-				printerFanPrint := prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterFanSpeedRpm], prometheus.GaugeValue,
-					status.Printer.FanPrint, c.GetLabels(s, job, "print")...)
+		ch <- printerNozzleSize
+	}
 
-				ch <- printerFanPrint
-			}
+	if c.metricEnabled(MetricPrinterPrintSpeedRatio) {
+		printSpeed := prometheus.MustNewConstMetric(
+			c.metricDesc[MetricPrinterPrintSpeedRatio], prometheus.GaugeValue,
+			printer.Telemetry.PrintSpeed/100,
+			c.GetLabels(s, job)...)
 
-			if c.metricEnabled(MetricPrinterNozzleSize) {
-				printerNozzleSize := prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterNozzleSize], prometheus.GaugeValue,
-					info.NozzleDiameter, c.GetLabels(s, job)...)
+		ch <- printSpeed
+	}
 
-				ch <- printerNozzleSize
-			}
+	if c.metricEnabled(MetricPrinterPrintTime) {
+		printTime := prometheus.MustNewConstMetric(
+			c.metricDesc[MetricPrinterPrintTime], prometheus.GaugeValue,
+			job.Progress.PrintTime,
+			c.GetLabels(s, job)...)
 
-			if c.metricEnabled(MetricPrinterPrintSpeedRatio) {
-				printSpeed := prometheus.MustNewConstMetric(
-					c.metricDesc[MetricPrinterPrintSpeedRatio], prometheus.GaugeValue,
-					printer.Telemetry.PrintSpeed/100,
-					c.GetLabels(s, job)...)
+		ch <- printTime
+	}
 
-				ch <- printSpeed
-			}
+	if c.metricEnabled(MetricPrinterPrintTimeRemaining) {
+		printTimeRemaining := prometheus.MustNewConstMetric(
+			c.metricDesc[MetricPrinterPrintTimeRemaining], prometheus.GaugeValue,
+			job.Progress.PrintTimeLeft,
+			c.GetLabels(s, job)...)
 
-			if c.metricEnabled(MetricPrinterPrintTime) {
-				printTime := prometheus.MustNewConstMetric(
-					c.metricDesc[MetricPrinterPrintTime], prometheus.GaugeValue,
-					job.Progress.PrintTime,
-					c.GetLabels(s, job)...)
+		ch <- printTimeRemaining
+	}
 
-				ch <- printTime
-			}
+	if c.metricEnabled(MetricPrinterPrintProgressRatio) {
+		printProgress := prometheus.MustNewConstMetric(
+			c.metricDesc[MetricPrinterPrintProgressRatio], prometheus.GaugeValue,
+			job.Progress.Completion,
+			c.GetLabels(s, job)...)
 
-			if c.metricEnabled(MetricPrinterPrintTimeRemaining) {
-				printTimeRemaining := prometheus.MustNewConstMetric(
-					c.metricDesc[MetricPrinterPrintTimeRemaining], prometheus.GaugeValue,
-					job.Progress.PrintTimeLeft,
-					c.GetLabels(s, job)...)
+		ch <- printProgress
+	}
 
-				ch <- printTimeRemaining
-			}
+	if c.metricEnabled(MetricPrinterMaterial) {
+		material := prometheus.MustNewConstMetric(
+			c.metricDesc[MetricPrinterMaterial], prometheus.GaugeValue,
+			BoolToFloat(!(strings.Contains(printer.Telemetry.Material, "-"))),
+			c.GetLabels(s, job, printer.Telemetry.Material)...)
 
-			if c.metricEnabled(MetricPrinterPrintProgressRatio) {
-				printProgress := prometheus.MustNewConstMetric(
-					c.metricDesc[MetricPrinterPrintProgressRatio], prometheus.GaugeValue,
-					job.Progress.Completion,
-					c.GetLabels(s, job)...)
+		ch <- material
+	}
 
-				ch <- printProgress
-			}
+	if c.metricEnabled(MetricPrinterAxis) {
+		printerAxisX := prometheus.MustNewConstMetric(
+			c.metricDesc[MetricPrinterAxis], prometheus.GaugeValue,
+			printer.Telemetry.AxisX,
+			c.GetLabels(s, job, "x")...)
 
-			if c.metricEnabled(MetricPrinterMaterial) {
-				material := prometheus.MustNewConstMetric(
-					c.metricDesc[MetricPrinterMaterial], prometheus.GaugeValue,
-					BoolToFloat(!(strings.Contains(printer.Telemetry.Material, "-"))),
-					c.GetLabels(s, job, printer.Telemetry.Material)...)
+		ch <- printerAxisX
 
-				ch <- material
-			}
+		printerAxisY := prometheus.MustNewConstMetric(
+			c.metricDesc[MetricPrinterAxis], prometheus.GaugeValue,
+			printer.Telemetry.AxisY,
+			c.GetLabels(s, job, "y")...)
 
-			if c.metricEnabled(MetricPrinterAxis) {
-				printerAxisX := prometheus.MustNewConstMetric(
-					c.metricDesc[MetricPrinterAxis], prometheus.GaugeValue,
-					printer.Telemetry.AxisX,
-					c.GetLabels(s, job, "x")...)
+		ch <- printerAxisY
 
-				ch <- printerAxisX
+		printerAxisZ := prometheus.MustNewConstMetric(
+			c.metricDesc[MetricPrinterAxis], prometheus.GaugeValue,
+			printer.Telemetry.AxisZ,
+			c.GetLabels(s, job, "z")...)
 
-				printerAxisY := prometheus.MustNewConstMetric(
-					c.metricDesc[MetricPrinterAxis], prometheus.GaugeValue,
-					printer.Telemetry.AxisY,
-					c.GetLabels(s, job, "y")...)
+		ch <- printerAxisZ
+	}
 
-				ch <- printerAxisY
+	if c.metricEnabled(MetricPrinterFlow) {
+		printerFlow := prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterFlow], prometheus.GaugeValue,
+			status.Printer.Flow/100, c.GetLabels(s, job)...)
 
-				printerAxisZ := prometheus.MustNewConstMetric(
-					c.metricDesc[MetricPrinterAxis], prometheus.GaugeValue,
-					printer.Telemetry.AxisZ,
-					c.GetLabels(s, job, "z")...)
+		ch <- printerFlow
+	}
 
-				ch <- printerAxisZ
-			}
+	if c.metricEnabled(MetricPrinterMMU) {
+		printerMMU := prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterMMU], prometheus.GaugeValue,
+			BoolToFloat(info.Mmu), c.GetLabels(s, job)...)
+		ch <- printerMMU
+	}
 
-			if c.metricEnabled(MetricPrinterFlow) {
-				printerFlow := prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterFlow], prometheus.GaugeValue,
-					status.Printer.Flow/100, c.GetLabels(s, job)...)
+	if c.metricEnabled(MetricPrinterTemp) {
+		printerBedTemp := prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterTemp], prometheus.GaugeValue,
+			printer.Temperature.Bed.Actual, c.GetLabels(s, job, "bed")...)
 
-				ch <- printerFlow
-			}
+		ch <- printerBedTemp
 
-			if c.metricEnabled(MetricPrinterMMU) {
-				printerMMU := prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterMMU], prometheus.GaugeValue,
-					BoolToFloat(info.Mmu), c.GetLabels(s, job)...)
-				ch <- printerMMU
-			}
+		printerToolTemp := prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterTemp], prometheus.GaugeValue,
+			printer.Temperature.Tool0.Actual, c.GetLabels(s, job, "tool0")...)
 
-			if c.metricEnabled(MetricPrinterTemp) {
-				printerBedTemp := prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterTemp], prometheus.GaugeValue,
-					printer.Temperature.Bed.Actual, c.GetLabels(s, job, "bed")...)
+		ch <- printerToolTemp
+	}
 
-				ch <- printerBedTemp
+	if c.metricEnabled(MetricPrinterTempTarget) {
+		printerBedTempTarget := prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterTempTarget], prometheus.GaugeValue,
+			printer.Temperature.Bed.Target, c.GetLabels(s, job, "bed")...)
 
-				printerToolTemp := prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterTemp], prometheus.GaugeValue,
-					printer.Temperature.Tool0.Actual, c.GetLabels(s, job, "tool0")...)
+		ch <- printerBedTempTarget
 
-				ch <- printerToolTemp
-			}
+		printerToolTempTarget := prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterTempTarget], prometheus.GaugeValue,
+			printer.Temperature.Tool0.Target, c.GetLabels(s, job, "tool0")...)
 
-			if c.metricEnabled(MetricPrinterTempTarget) {
-				printerBedTempTarget := prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterTempTarget], prometheus.GaugeValue,
-					printer.Temperature.Bed.Target, c.GetLabels(s, job, "bed")...)
+		ch <- printerToolTempTarget
+	}
 
-				ch <- printerBedTempTarget
+	if c.metricEnabled(MetricPrinterStatus) {
+		printerStatus := prometheus.MustNewConstMetric(
+			c.metricDesc[MetricPrinterStatus], prometheus.GaugeValue,
+			GetStateFlag(printer),
+			c.GetLabels(s, job, printer.State.Text)...)
 
-				printerToolTempTarget := prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterTempTarget], prometheus.GaugeValue,
-					printer.Temperature.Tool0.Target, c.GetLabels(s, job, "tool0")...)
+		ch <- printerStatus
+	}
 
-				ch <- printerToolTempTarget
-			}
+	c.collectJob(ch, snap)
+	c.collectStorage(ch, snap)
+	c.collectCameras(ch, snap)
 
-			if c.metricEnabled(MetricPrinterStatus) {
-				printerStatus := prometheus.MustNewConstMetric(
-					c.metricDesc[MetricPrinterStatus], prometheus.GaugeValue,
-					getStateFlag(printer),
-					c.GetLabels(s, job, printer.State.Text)...)
+	if c.metricEnabled(MetricPrinterJobImage) && snap.thumbnail != nil {
+		printerJobImage := prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterJobImage], prometheus.GaugeValue,
+			1, c.GetLabels(s, job, thumbnailURL(s, snap.thumbnail))...)
 
-				ch <- printerStatus
-			}
+		ch <- printerJobImage
+	}
 
-			if c.metricEnabled(MetricPrinterJobImage) && getStateFlag(printer) == 4 {
-				image, err := GetJobImage(s, job.Job.File.Path)
+	printerUp := prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterUp], prometheus.GaugeValue,
+		1, s.Address, s.Type, s.Name)
 
-				if err != nil {
-					log.Error().Msg("Error while scraping image endpoint at " + s.Address + " - " + err.Error())
-				} else {
-					printerJobImage := prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterJobImage], prometheus.GaugeValue,
-						1, c.GetLabels(s, job, image)...)
+	ch <- printerUp
+}
 
-					ch <- printerJobImage
-				}
+// gauge is a value of metric that is sent only if send is set
+type gauge struct {
+	metric MetricName
+	value  float64
+	send   bool
+}
 
+// collectStorage sends metrics of storages of the printer and summary of files stored in them
+func (c *Collector) collectStorage(ch chan<- prometheus.Metric, snap *snapshot) {
+	s, job := snap.printer, snap.job
+
+	for _, storage := range snap.storage.StorageList {
+		name := storageName(storage.Path)
+		gauges := []gauge{
+			{MetricPrinterStorageAvailable, BoolToFloat(storage.Available), true},
+			{MetricPrinterStorageReadOnly, BoolToFloat(storage.ReadOnly), true},
+			{MetricPrinterStorageFree, storage.FreeSpace, storage.TotalSpace > 0}, // not sent by Buddy printers
+			{MetricPrinterStorageTotal, storage.TotalSpace, storage.TotalSpace > 0},
+		}
+		if storage.PrintFiles != nil {
+			gauges = append(gauges, gauge{MetricPrinterStoragePrintFiles, *storage.PrintFiles, true})
+		}
+		if storage.SystemFiles != nil {
+			gauges = append(gauges, gauge{MetricPrinterStorageSystemFiles, *storage.SystemFiles, true})
+		}
+		for _, g := range gauges {
+			if g.send && c.metricEnabled(g.metric) {
+				ch <- prometheus.MustNewConstMetric(c.metricDesc[g.metric], prometheus.GaugeValue,
+					g.value, c.GetLabels(s, job, name)...)
 			}
+		}
+	}
 
-			printerUp = prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterUp], prometheus.GaugeValue,
-				1, s.Address, s.Type, s.Name)
-
-			ch <- printerUp
-
-			log.Debug().Msg("Scraping done at " + s.Address)
-		}(s)
+	for name, files := range snap.files {
+		if c.metricEnabled(MetricPrinterFiles) {
+			for extension, count := range files.count {
+				ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterFiles], prometheus.GaugeValue,
+					count, c.GetLabels(s, job, name, extension)...)
+			}
+		}
+		if c.metricEnabled(MetricPrinterFilesSize) {
+			ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterFilesSize], prometheus.GaugeValue,
+				files.size, c.GetLabels(s, job, name)...)
+		}
+		if c.metricEnabled(MetricPrinterFilesNewest) && files.newest > 0 {
+			ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterFilesNewest], prometheus.GaugeValue,
+				files.newest, c.GetLabels(s, job, name)...)
+		}
 	}
-	wg.Wait()
 }
 
 // GetLabels is used to get the labels for the given printer and job
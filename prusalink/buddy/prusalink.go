@@ -2,12 +2,14 @@ package prusalink
 
 import (
 	"bytes"
-	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"image"
 	"image/png"
 	"io"
 	"net/http"
+	"net/url"
+	"sync"
 	"time"
 
 	"github.com/icholy/digest"
@@ -16,21 +18,6 @@ import (
 )
 
 var (
-	/*printerBoards = map[string]string{
-		"MINI":    "buddy",
-		"MK35":    "buddy",
-		"MK39":    "buddy",
-		"MK4":     "buddy",
-		"XL":      "buddy",
-		"IX":      "buddy",
-		"I3MK3S":  "einsy",
-		"I3MK3":   "einsy",
-		"I3MK25S": "einsy",
-		"I3MK25":  "einsy",
-		"SL1":     "sl",
-		"SL1S":    "sl",
-	}*/
-
 	// used for autodetection - does not work with changed hostname :sad:
 	printerTypes = map[string]string{
 		"PrusaMINI":         "MINI",
@@ -45,9 +32,23 @@ var (
 		"Prusa_iX":          "IX", // can be found in src/common/config.h in firmware source code
 	}
 
-	configuration config.Config
+	configuration   config.Config
+	configurationMu sync.RWMutex
 )
 
+func setConfiguration(config config.Config) {
+	configurationMu.Lock()
+	defer configurationMu.Unlock()
+	configuration = config
+}
+
+// scrapeTimeout returns the configured PrusaLink scrape timeout
+func scrapeTimeout() time.Duration {
+	configurationMu.RLock()
+	defer configurationMu.RUnlock()
+	return time.Duration(configuration.Exporter.ScrapeTimeout)
+}
+
 // BoolToFloat is used for basic parsing boolean to float64
 // 0.0 for false, 1.0 for true
 func BoolToFloat(boolean bool) float64 {
@@ -58,97 +59,122 @@ func BoolToFloat(boolean bool) float64 {
 	return 1.0
 }
 
-// getStateFlag returns the state flag for the given printer.
+// GetStateFlag returns the state flag for the given printer.
 // The state flag is a float64 value representing the current state of the printer.
-// It is used for tracking the printer's status and progress.
-func getStateFlag(printer Printer) float64 {
-	if printer.State.Flags.Operational {
-		return 1
-	} else if printer.State.Flags.Prepared {
-		return 2
-	} else if printer.State.Flags.Paused {
-		return 3
-	} else if printer.State.Flags.Printing {
-		return 4
-	} else if printer.State.Flags.Cancelling {
+// It is used for tracking the printer's status and progress. Printers report operational
+// while they print too, so the states of a job are checked first.
+func GetStateFlag(printer Printer) float64 {
+	flags := printer.State.Flags
+	switch {
+	case flags.Cancelling:
 		return 5
-	} else if printer.State.Flags.Pausing {
+	case flags.Pausing:
 		return 6
-	} else if printer.State.Flags.Error {
+	case flags.Paused:
+		return 3
+	case flags.Printing:
+		return 4
+	case flags.Error:
 		return 7
-	} else if printer.State.Flags.SdReady {
+	case flags.Operational:
+		return 1
+	case flags.Prepared:
+		return 2
+	case flags.SdReady:
 		return 8
-	} else if printer.State.Flags.ClosedOrError || printer.State.Flags.ClosedOnError {
+	case flags.ClosedOrError || flags.ClosedOnError:
 		return 9
-	} else if printer.State.Flags.Ready {
+	case flags.Ready:
 		return 10
-	} else if printer.State.Flags.Busy {
+	case flags.Busy:
 		return 11
-	} else if printer.State.Flags.Finished {
+	case flags.Finished:
 		return 12
-	} else {
+	default:
 		return 0
 	}
 }
 
 // accessPrinterEndpoint is used to access the printer's API endpoint
 func accessPrinterEndpoint(path string, printer config.Printers) ([]byte, error) {
+	result, _, err := requestPrinterEndpoint("GET", path, printer)
+	return result, err
+}
+
+// GetEndpoint is used to access the printer's API endpoint and decode its JSON response into v.
+// No content leaves v untouched, other responses than 2xx are returned as error.
+func GetEndpoint(path string, printer config.Printers, v any) error {
+	response, status, err := requestPrinterEndpoint("GET", path, printer)
+
+	if err != nil {
+		return err
+	}
+
+	if status == http.StatusNoContent {
+		return nil
+	}
+
+	if status < 200 || status >= 300 {
+		return fmt.Errorf("printer %s returned %d for %s", printer.Address, status, path)
+	}
+
+	err = json.Unmarshal(response, v)
+	if err != nil {
+		observeDecodeError(path, printer)
+	}
+
+	return err
+}
+
+// requestPrinterEndpoint sends a request with the given method to the printer's API endpoint
+// and returns the response body together with the HTTP status code
+func requestPrinterEndpoint(method string, path string, printer config.Printers) ([]byte, int, error) {
 	url := string("http://" + printer.Address + path)
 	var (
 		res    *http.Response
 		result []byte
-		err    error
 	)
 
-	if printer.Apikey == "" {
-		client := &http.Client{
-			Transport: &digest.Transport{
-				Username: printer.Username,
-				Password: printer.Password,
-			},
-			Timeout: 5 * time.Duration(configuration.Exporter.ScrapeTimeout) * time.Second,
-		}
-		res, err = client.Get(url)
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return result, 0, err
+	}
 
-		if err != nil {
-			return result, err
-		}
-	} else {
-		req, err := http.NewRequest("GET", url, nil)
-		client := &http.Client{
-			Timeout: 5 * time.Duration(configuration.Exporter.ScrapeTimeout) * time.Second,
-		}
+	client := &http.Client{
+		Timeout: 5 * scrapeTimeout() * time.Second,
+	}
 
-		if err != nil {
-			return result, err
+	if printer.Apikey == "" {
+		client.Transport = &digest.Transport{
+			Username: printer.Username,
+			Password: printer.Password,
 		}
-
+	} else {
 		req.Header.Add("X-Api-Key", printer.Apikey)
-		res, err = client.Do(req)
-		if err != nil {
-			return result, err
-		}
 	}
+
+	start := time.Now()
+	res, err = client.Do(req)
+	if err != nil {
+		observeRequest(path, printer, start, 0)
+		return result, 0, err
+	}
+
 	result, err = io.ReadAll(res.Body)
 	res.Body.Close()
+	observeRequest(path, printer, start, res.StatusCode)
 
 	if err != nil {
 		log.Error().Msg(err.Error())
 	}
 
-	return result, nil
+	return result, res.StatusCode, nil
 }
 
 // GetVersion is used to get the printer's version API endpoint
 func GetVersion(printer config.Printers) (Version, error) {
 	var version Version
-	response, err := accessPrinterEndpoint("/api/version", printer)
-
-	if err != nil {
-		return version, err
-	}
-
-	err = json.Unmarshal(response, &version)
+	err := GetEndpoint("/api/version", printer, &version)
 
 	return version, err
 }
@@ -156,13 +182,7 @@ func GetVersion(printer config.Printers) (Version, error) {
 // GetJob is used to get the printer's job API endpoint
 func GetJob(printer config.Printers) (Job, error) {
 	var job Job
-	response, err := accessPrinterEndpoint("/api/job", printer)
-
-	if err != nil {
-		return job, err
-	}
-
-	err = json.Unmarshal(response, &job)
+	err := GetEndpoint("/api/job", printer, &job)
 
 	return job, err
 }
@@ -170,13 +190,7 @@ func GetJob(printer config.Printers) (Job, error) {
 // GetPrinter is used to get the printer's printer API endpoint
 func GetPrinter(printer config.Printers) (Printer, error) {
 	var printerData Printer
-	response, err := accessPrinterEndpoint("/api/printer", printer)
-
-	if err != nil {
-		return printerData, err
-	}
-
-	err = json.Unmarshal(response, &printerData)
+	err := GetEndpoint("/api/printer", printer, &printerData)
 
 	return printerData, err
 }
@@ -184,13 +198,7 @@ func GetPrinter(printer config.Printers) (Printer, error) {
 // GetFiles is used to get the printer's files API endpoint
 func GetFiles(printer config.Printers) (Files, error) {
 	var files Files
-	response, err := accessPrinterEndpoint("/api/files?recursive=true", printer)
-
-	if err != nil {
-		return files, err
-	}
-
-	err = json.Unmarshal(response, &files)
+	err := GetEndpoint("/api/files?recursive=true", printer, &files)
 
 	return files, err
 }
@@ -198,13 +206,7 @@ func GetFiles(printer config.Printers) (Files, error) {
 // GetJobV1 is used to get the printer's job v1 API endpoint
 func GetJobV1(printer config.Printers) (JobV1, error) {
 	var job JobV1
-	response, err := accessPrinterEndpoint("/api/v1/job", printer)
-
-	if err != nil {
-		return job, err
-	}
-
-	err = json.Unmarshal(response, &job)
+	err := GetEndpoint("/api/v1/job", printer, &job)
 
 	return job, err
 }
@@ -212,13 +214,7 @@ func GetJobV1(printer config.Printers) (JobV1, error) {
 // GetStatus is used to get Buddy status endpoint
 func GetStatus(printer config.Printers) (Status, error) {
 	var status Status
-	response, err := accessPrinterEndpoint("/api/v1/status", printer)
-
-	if err != nil {
-		return status, err
-	}
-
-	err = json.Unmarshal(response, &status)
+	err := GetEndpoint("/api/v1/status", printer, &status)
 
 	return status, err
 }
@@ -226,13 +222,7 @@ func GetStatus(printer config.Printers) (Status, error) {
 // GetStorageV1 is used to get the printer's storage v1 API endpoint
 func GetStorageV1(printer config.Printers) (StorageV1, error) {
 	var storage StorageV1
-	response, err := accessPrinterEndpoint("/api/v1/storage", printer)
-
-	if err != nil {
-		return storage, err
-	}
-
-	err = json.Unmarshal(response, &storage)
+	err := GetEndpoint("/api/v1/storage", printer, &storage)
 
 	return storage, err
 }
@@ -240,13 +230,7 @@ func GetStorageV1(printer config.Printers) (StorageV1, error) {
 // GetInfo is used to get the printer's info API endpoint
 func GetInfo(printer config.Printers) (Info, error) {
 	var info Info
-	response, err := accessPrinterEndpoint("/api/v1/info", printer)
-
-	if err != nil {
-		return info, err
-	}
-
-	err = json.Unmarshal(response, &info)
+	err := GetEndpoint("/api/v1/info", printer, &info)
 
 	return info, err
 }
@@ -254,13 +238,7 @@ func GetInfo(printer config.Printers) (Info, error) {
 // GetSettings is used to get the printer's settings API endpoint
 func GetSettings(printer config.Printers) (Settings, error) {
 	var settings Settings
-	response, err := accessPrinterEndpoint("/api/settings", printer)
-
-	if err != nil {
-		return settings, err
-	}
-
-	err = json.Unmarshal(response, &settings)
+	err := GetEndpoint("/api/settings", printer, &settings)
 
 	return settings, err
 }
@@ -268,43 +246,84 @@ func GetSettings(printer config.Printers) (Settings, error) {
 // GetCameras is used to get the printer's cameras API endpoint
 func GetCameras(printer config.Printers) (Cameras, error) {
 	var cameras Cameras
-	response, err := accessPrinterEndpoint("/api/v1/cameras", printer)
+	err := GetEndpoint("/api/v1/cameras", printer, &cameras)
+
+	return cameras, err
+}
+
+// GetCameraSnapshot is used to get the latest image taken by the printer's camera
+func GetCameraSnapshot(printer config.Printers, cameraID string) ([]byte, error) {
+	path := "/api/v1/cameras/" + url.PathEscape(cameraID) + "/snap"
+	response, status, err := requestPrinterEndpoint("GET", path, printer)
 
 	if err != nil {
-		return cameras, err
+		return nil, err
 	}
 
-	err = json.Unmarshal(response, &cameras)
+	if status == http.StatusNoContent {
+		return nil, fmt.Errorf("camera %s of printer %s has no snapshot yet", cameraID, printer.Address)
+	}
 
-	return cameras, err
+	if status < 200 || status >= 300 {
+		return nil, fmt.Errorf("printer %s returned %d for %s", printer.Address, status, path)
+	}
+
+	return response, nil
 }
 
 // GetPrinterProfiles is used to get the printer's printerprofiles API endpoint
 func GetPrinterProfiles(printer config.Printers) (PrinterProfiles, error) {
 	var profiles PrinterProfiles
-	response, err := accessPrinterEndpoint("/api/v1/printerprofiles", printer)
+	err := GetEndpoint("/api/v1/printerprofiles", printer, &profiles)
+
+	return profiles, err
+}
+
+// PauseJob pauses the print job with the given id
+func PauseJob(printer config.Printers, id int) error {
+	return controlJob("PUT", fmt.Sprintf("/api/v1/job/%d/pause", id), printer)
+}
+
+// ResumeJob resumes the paused print job with the given id
+func ResumeJob(printer config.Printers, id int) error {
+	return controlJob("PUT", fmt.Sprintf("/api/v1/job/%d/resume", id), printer)
+}
+
+// StopJob stops the print job with the given id
+func StopJob(printer config.Printers, id int) error {
+	return controlJob("DELETE", fmt.Sprintf("/api/v1/job/%d", id), printer)
+}
+
+// controlJob sends a job control request and checks that the printer accepted it
+func controlJob(method string, path string, printer config.Printers) error {
+	response, status, err := requestPrinterEndpoint(method, path, printer)
 
 	if err != nil {
-		return profiles, err
+		return err
 	}
 
-	err = json.Unmarshal(response, &profiles)
+	if status != http.StatusNoContent && status != http.StatusOK {
+		return fmt.Errorf("printer %s returned %d for %s %s: %s", printer.Address, status, method, path, bytes.TrimSpace(response))
+	}
 
-	return profiles, err
+	return nil
 }
 
-// GetJobImage is used to get the printer's job image from API
-func GetJobImage(printer config.Printers, imagePath string) (string, error) { // returns base64 encoded image
+// GetJobThumbnail is used to get the printer's job image from API as compressed PNG
+func GetJobThumbnail(printer config.Printers, imagePath string) ([]byte, error) {
 	//http://192.168.20.50/thumb/l/usb/PYTHON~1.BGC
 	response, err := accessPrinterEndpoint("/thumb/l"+imagePath, printer)
 
-	image, err := compressPNG(response, png.BestCompression)
+	if err != nil {
+		return nil, err
+	}
 
+	thumbnail, err := compressPNG(response, png.BestCompression)
 	if err != nil {
-		return "", err
+		observeDecodeError("/thumb/l"+imagePath, printer)
 	}
 
-	return base64.StdEncoding.EncodeToString(image), err
+	return thumbnail, err
 }
 
 func compressPNG(input []byte, compressionLevel png.CompressionLevel) ([]byte, error) {
@@ -364,24 +383,24 @@ func GetPrinterType(printer config.Printers) (string, error) {
 	return printerType, nil
 }
 
-// ProbePrinter is used to probe the printer - just testing the connection
+// probeTimeout limits ProbePrinter, subnet scan probes mostly addresses where nothing answers
+const probeTimeout = time.Second
+
+// ProbePrinter is used to probe the printer - just testing the connection.
+// Printer that requires authentication is found as well, credentials are checked by the following requests.
 func ProbePrinter(printer config.Printers) (bool, error) {
 	req, _ := http.NewRequest("GET", "http://"+printer.Address+"/", nil)
-	client := &http.Client{Timeout: time.Duration(configuration.Exporter.ScrapeTimeout) * time.Millisecond}
+	client := &http.Client{Timeout: probeTimeout}
 	r, e := client.Do(req)
 
 	if e != nil {
 		return false, e
 	}
+	r.Body.Close()
 
 	if r.StatusCode == 401 {
-		log.Debug().Msg("401 Unauthorized, trying to access with API key - " + printer.Address)
-		req, _ := http.NewRequest("GET", "http://"+printer.Address+"/api/v1/status", nil)
-		req.Header.Add("X-Api-Key", printer.Apikey)
-		r, e = client.Do(req)
-		if e != nil {
-			return false, e
-		}
+		log.Debug().Msg("401 Unauthorized, PrusaLink with authentication found - " + printer.Address)
+		return true, nil
 	}
 
 	return r.StatusCode == 200, nil
@@ -0,0 +1,107 @@
+package prusalink
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/pstrobl96/prusa_exporter/config"
+)
+
+// Metrics of the exporter itself, they tell which printer or endpoint fails when the dashboard goes blank
+var (
+	requestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "prusa_exporter_request_duration_seconds",
+			Help:    "Duration of requests to PrusaLink API endpoints.",
+			Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+		},
+		[]string{"printer_address", "printer_name", "endpoint"},
+	)
+	requestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "prusa_exporter_requests_total",
+			Help: "Number of requests to PrusaLink API endpoints by HTTP status code. Code is error when no response was received.",
+		},
+		[]string{"printer_address", "printer_name", "endpoint", "code"},
+	)
+	decodeErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "prusa_exporter_decode_errors_total",
+			Help: "Number of PrusaLink API responses that could not be decoded.",
+		},
+		[]string{"printer_address", "printer_name", "endpoint"},
+	)
+	lastSuccess = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "prusa_exporter_last_success_timestamp_seconds",
+			Help: "Last time all essential PrusaLink endpoints of the printer were scraped successfully.",
+		},
+		[]string{"printer_address", "printer_name"},
+	)
+	scrapeDuration = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "prusa_exporter_scrape_duration_seconds",
+			Help: "Duration of the last scrape of all PrusaLink endpoints of the printer.",
+		},
+		[]string{"printer_address", "printer_name"},
+	)
+
+	selfMetrics = []prometheus.Collector{requestDuration, requestsTotal, decodeErrors, lastSuccess, scrapeDuration}
+
+	// numericSegment matches ids in paths like /api/v1/job/113/pause
+	numericSegment = regexp.MustCompile(`/[0-9]+(/|$)`)
+)
+
+// endpointLabel returns path of the endpoint without query, file path of thumbnails and ids
+func endpointLabel(path string) string {
+	path, _, _ = strings.Cut(path, "?")
+	if strings.HasPrefix(path, "/thumb/") {
+		return path[:min(len(path), len("/thumb/l"))]
+	}
+	return numericSegment.ReplaceAllString(path, "/{id}$1")
+}
+
+func observeRequest(path string, printer config.Printers, start time.Time, code int) {
+	if printer.Probe {
+		return
+	}
+	endpoint := endpointLabel(path)
+	requestDuration.WithLabelValues(printer.Address, printer.Name, endpoint).Observe(time.Since(start).Seconds())
+
+	status := "error"
+	if code != 0 {
+		status = strconv.Itoa(code)
+	}
+	requestsTotal.WithLabelValues(printer.Address, printer.Name, endpoint, status).Inc()
+}
+
+func observeDecodeError(path string, printer config.Printers) {
+	if printer.Probe {
+		return
+	}
+	decodeErrors.WithLabelValues(printer.Address, printer.Name, endpointLabel(path)).Inc()
+}
+
+// ObserveScrape records duration of a scrape of the printer and time of the last successful one.
+// Probed printers are not recorded, nothing would remove their series.
+func ObserveScrape(printer config.Printers, start time.Time, up bool) {
+	if printer.Probe {
+		return
+	}
+	scrapeDuration.WithLabelValues(printer.Address, printer.Name).Set(time.Since(start).Seconds())
+	if up {
+		lastSuccess.WithLabelValues(printer.Address, printer.Name).SetToCurrentTime()
+	}
+}
+
+// ForgetPrinter removes metrics of the exporter about the printer, it is called when the printer is removed from configuration
+func ForgetPrinter(printer config.Printers) {
+	for _, metric := range []interface {
+		DeletePartialMatch(prometheus.Labels) int
+	}{requestDuration, requestsTotal, decodeErrors, lastSuccess, scrapeDuration} {
+		metric.DeletePartialMatch(prometheus.Labels{"printer_address": printer.Address})
+	}
+}
@@ -0,0 +1,78 @@
+package prusalink
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/pstrobl96/prusa_exporter/config"
+)
+
+func TestEndpointLabel(t *testing.T) {
+	for path, expected := range map[string]string{
+		"/api/job":                      "/api/job",
+		"/api/files?recursive=true":     "/api/files",
+		"/api/v1/job/113/pause":         "/api/v1/job/{id}/pause",
+		"/api/v1/job/113":               "/api/v1/job/{id}",
+		"/thumb/l/usb/MULTIP~1.BGC":     "/thumb/l",
+		"/api/v1/cameras/2/snap":        "/api/v1/cameras/{id}/snap",
+		"/api/v1/files/usb/1234abc.bgc": "/api/v1/files/usb/1234abc.bgc",
+	} {
+		if label := endpointLabel(path); label != expected {
+			t.Errorf("endpointLabel(%q) = %q, expected %q", path, label, expected)
+		}
+	}
+}
+
+func TestRequestMetrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/version":
+			w.Write([]byte(`{"api":"2.0.0"}`))
+		case "/api/job":
+			w.Write([]byte(`<html>not json</html>`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	printer := config.Printers{Address: strings.TrimPrefix(server.URL, "http://"), Name: "test", Apikey: "key"}
+	defer ForgetPrinter(printer)
+
+	if _, err := GetVersion(printer); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetJob(printer); err == nil {
+		t.Error("GetJob: expected decode error")
+	}
+	if _, err := GetStatus(printer); err == nil || strings.Contains(err.Error(), "JSON") {
+		t.Errorf("GetStatus: expected error with status code, got %v", err)
+	}
+
+	for _, c := range []struct {
+		endpoint, code string
+		expected       float64
+	}{
+		{"/api/version", "200", 1},
+		{"/api/job", "200", 1},
+		{"/api/v1/status", "404", 1},
+	} {
+		if value := testutil.ToFloat64(requestsTotal.WithLabelValues(printer.Address, printer.Name, c.endpoint, c.code)); value != c.expected {
+			t.Errorf("requests of %s with code %s = %v, expected %v", c.endpoint, c.code, value, c.expected)
+		}
+	}
+	if value := testutil.ToFloat64(decodeErrors.WithLabelValues(printer.Address, printer.Name, "/api/job")); value != 1 {
+		t.Errorf("decode errors of /api/job = %v, expected 1", value)
+	}
+	if count := testutil.CollectAndCount(decodeErrors); count != 1 {
+		t.Errorf("expected decode error only for /api/job, got %d series", count)
+	}
+
+	ForgetPrinter(printer)
+	if count := testutil.CollectAndCount(requestsTotal); count != 0 {
+		t.Errorf("expected no series after ForgetPrinter, got %d", count)
+	}
+}
@@ -111,32 +111,27 @@ type Printer struct {
 
 // Files is a struct that contains data about the files on the printer
 type Files struct {
-	Files []struct {
-		Name     string `json:"name"`
-		Path     string `json:"path"`
-		Display  string `json:"display"`
-		Type     string `json:"type"`
-		Origin   string `json:"origin"`
-		Children []struct {
-			Name    string `json:"name"`
-			Display string `json:"display"`
-			Path    string `json:"path"`
-			Origin  string `json:"origin"`
-			Refs    struct {
-				Resource       string `json:"resource"`
-				ThumbnailSmall string `json:"thumbnailSmall"`
-				ThumbnailBig   string `json:"thumbnailBig"`
-				Download       string `json:"download"`
-			} `json:"refs"`
-		} `json:"children"`
-		Date     float64  `json:"date"`
-		Size     float64  `json:"size"`
-		TypePath []string `json:"typePath"`
-		Refs     struct {
-			Resource any `json:"resource"`
-		} `json:"refs"`
-		ReadOnly bool `json:"read_only,omitempty"`
-	} `json:"files"`
+	Files []File `json:"files"`
+}
+
+// File is a file or a folder on the printer, folders contain their files in children
+type File struct {
+	Name     string   `json:"name"`
+	Path     string   `json:"path"`
+	Display  string   `json:"display"`
+	Type     string   `json:"type"`
+	Origin   string   `json:"origin"`
+	Children []File   `json:"children"`
+	Date     float64  `json:"date"`
+	Size     float64  `json:"size"`
+	TypePath []string `json:"typePath"`
+	Refs     struct {
+		Resource       any    `json:"resource"`
+		ThumbnailSmall string `json:"thumbnailSmall"`
+		ThumbnailBig   string `json:"thumbnailBig"`
+		Download       string `json:"download"`
+	} `json:"refs"`
+	ReadOnly bool `json:"read_only,omitempty"`
 }
 
 // JobV1 is a struct that contains data about the print job from path /api/v1/job
@@ -196,15 +191,15 @@ type Status struct {
 // StorageV1 is a struct that contains data about the storage from path /api/v1/storage
 type StorageV1 struct {
 	StorageList []struct {
-		Path        string  `json:"path"`
-		Name        string  `json:"name"`
-		Type        string  `json:"type"`
-		ReadOnly    bool    `json:"read_only"`
-		Available   bool    `json:"available"`
-		FreeSpace   float64 `json:"free_space,omitempty"`
-		TotalSpace  float64 `json:"total_space,omitempty"`
-		PrintFiles  float64 `json:"print_files"`
-		SystemFiles float64 `json:"system_files"`
+		Path        string   `json:"path"`
+		Name        string   `json:"name"`
+		Type        string   `json:"type"`
+		ReadOnly    bool     `json:"read_only"`
+		Available   bool     `json:"available"`
+		FreeSpace   float64  `json:"free_space,omitempty"`
+		TotalSpace  float64  `json:"total_space,omitempty"`
+		PrintFiles  *float64 `json:"print_files,omitempty"` // bytes, not sent by Buddy printers
+		SystemFiles *float64 `json:"system_files,omitempty"`
 	} `json:"storage_list"`
 }
 
@@ -0,0 +1,61 @@
+package prusalink
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/pstrobl96/prusa_exporter/config"
+)
+
+// thumbnailID returns the identifier of the printer used in thumbnail URL - name, or address if the printer has no name
+func thumbnailID(printer config.Printers) string {
+	if printer.Name != "" {
+		return printer.Name
+	}
+	return printer.Address
+}
+
+// thumbnailURL returns path where the thumbnail of the current job is served.
+// Hash in the query makes the URL unique for every job image.
+func thumbnailURL(printer config.Printers, thumb *thumbnail) string {
+	return "/printers/" + url.PathEscape(thumbnailID(printer)) + "/thumbnail.png?v=" + thumb.hash
+}
+
+// ServeThumbnail handles GET /printers/{name}/thumbnail.png with the image of the current print job
+func (c *Collector) ServeThumbnail(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	c.mu.RLock()
+	var thumb *thumbnail
+	for _, printer := range c.configuration.Printers {
+		if thumbnailID(printer) != name {
+			continue
+		}
+		if p, ok := c.pollers[printer.Address]; ok {
+			if snap := p.snapshot(); snap != nil {
+				thumb = snap.thumbnail
+			}
+		}
+		break
+	}
+	c.mu.RUnlock()
+
+	if thumb == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	etag := `"` + thumb.hash + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Content-Length", strconv.Itoa(len(thumb.png)))
+	w.Write(thumb.png)
+}
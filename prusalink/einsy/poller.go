@@ -0,0 +1,130 @@
+package prusalink
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pstrobl96/prusa_exporter/config"
+	buddy "github.com/pstrobl96/prusa_exporter/prusalink/buddy"
+	"github.com/rs/zerolog/log"
+)
+
+// snapshot is the data fetched from an Einsy printer in one poll
+type snapshot struct {
+	printer config.Printers
+	time    time.Time
+	up      bool
+
+	job         buddy.Job
+	printerData Printer
+	version     buddy.Version
+	status      Status
+	info        buddy.Info
+}
+
+// fetchSnapshot queries PrusaLink endpoints of the Einsy printer.
+// The snapshot is returned as down if one of the essential endpoints fails.
+func fetchSnapshot(s config.Printers) *snapshot {
+	var err error
+	snap := &snapshot{printer: s}
+	start := time.Now()
+	defer func() {
+		snap.time = time.Now()
+		buddy.ObserveScrape(s, start, snap.up)
+	}()
+
+	log.Debug().Msg("Einsy printer scraping at " + s.Address)
+
+	snap.job, err = buddy.GetJob(s)
+	if err != nil {
+		log.Error().Msg("Error while scraping job endpoint at " + s.Address + " - " + err.Error())
+		return snap
+	}
+
+	snap.printerData, err = GetPrinter(s)
+	if err != nil {
+		log.Error().Msg("Error while scraping printer endpoint at " + s.Address + " - " + err.Error())
+		return snap
+	}
+
+	snap.version, err = buddy.GetVersion(s)
+	if err != nil {
+		log.Error().Msg("Error while scraping version endpoint at " + s.Address + " - " + err.Error())
+		return snap
+	}
+
+	snap.status, err = GetStatus(s)
+	if err != nil {
+		log.Error().Msg("Error while scraping status endpoint at " + s.Address + " - " + err.Error())
+	}
+
+	snap.info, err = buddy.GetInfo(s)
+	if err != nil {
+		log.Error().Msg("Error while scraping info endpoint at " + s.Address + " - " + err.Error())
+	}
+
+	snap.up = true
+	log.Debug().Msg("Scraping done at " + s.Address)
+
+	return snap
+}
+
+// poller refreshes the snapshot of a single Einsy printer on its own interval
+type poller struct {
+	printer  config.Printers
+	interval time.Duration
+
+	mu   sync.RWMutex
+	last *snapshot
+
+	stop chan struct{}
+}
+
+func newPoller(printer config.Printers, interval time.Duration) *poller {
+	return &poller{
+		printer:  printer,
+		interval: interval,
+		stop:     make(chan struct{}),
+	}
+}
+
+func (p *poller) run() {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		snap := fetchSnapshot(p.printer)
+		if snap.up {
+			buddy.TrackJob(p.printer, snap.time, buddy.JobState{
+				ID:          int(snap.status.Job.ID),
+				State:       snap.status.Printer.State,
+				Name:        snap.job.Job.File.Name,
+				DisplayName: snap.job.Job.File.Display,
+				Path:        snap.job.Job.File.Path,
+				PrintTime:   snap.job.Progress.PrintTime,
+			})
+		}
+
+		p.mu.Lock()
+		p.last = snap
+		p.mu.Unlock()
+
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// snapshot returns the latest snapshot or nil if the printer was not polled yet
+func (p *poller) snapshot() *snapshot {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.last
+}
+
+// close stops the poller. It does not wait for a poll in progress.
+func (p *poller) close() {
+	close(p.stop)
+}
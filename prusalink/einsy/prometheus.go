@@ -0,0 +1,303 @@
+package prusalink
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/pstrobl96/prusa_exporter/config"
+	buddy "github.com/pstrobl96/prusa_exporter/prusalink/buddy"
+)
+
+// Collector is a struct of all Einsy printer metrics
+type Collector struct {
+	mu sync.RWMutex
+
+	metricDesc     map[buddy.MetricName]*prometheus.Desc
+	metricDisabled map[buddy.MetricName]bool
+
+	configuration config.Config
+	commonLabels  []string
+
+	pollers map[string]*poller
+}
+
+const (
+	MetricPrinterLinkOk buddy.MetricName = "prusa_link_ok"
+)
+
+type metricDesc struct {
+	Name        buddy.MetricName
+	Description string
+	Labels      []string
+}
+
+// metrics exposed only by Einsy printers
+var metrics = []metricDesc{
+	{MetricPrinterLinkOk, "Returns 1 if PrusaLink reports the service as working.", []string{"printer_link_service", "printer_link_message"}},
+}
+
+// sharedMetrics have the same meaning for Einsy printers, their descriptors are taken from the Buddy collector
+var sharedMetrics = []buddy.MetricName{
+	buddy.MetricPrinterUp,
+	buddy.MetricPrinterSnapshotAge,
+	buddy.MetricPrinterCurrentJob,
+	buddy.MetricPrinterInfo,
+	buddy.MetricPrinterStatus,
+	buddy.MetricPrinterTemp,
+	buddy.MetricPrinterTempTarget,
+	buddy.MetricPrinterFanSpeedRpm,
+	buddy.MetricPrinterNozzleSize,
+	buddy.MetricPrinterPrintSpeedRatio,
+	buddy.MetricPrinterPrintTime,
+	buddy.MetricPrinterPrintTimeRemaining,
+	buddy.MetricPrinterPrintProgressRatio,
+	buddy.MetricPrinterMaterial,
+	buddy.MetricPrinterAxis,
+	buddy.MetricPrinterFlow,
+	buddy.MetricPrinterStorageFree,
+	buddy.MetricPrinterStorageTotal,
+}
+
+func (c *Collector) metricEnabled(m buddy.MetricName) bool {
+	return !c.metricDisabled[m]
+}
+
+// NewCollector returns a new Collector for Einsy printer metrics
+func NewCollector(config config.Config) *Collector {
+	c := &Collector{}
+	c.apply(config)
+	return c
+}
+
+// Reload swaps the printer list, common labels and disabled metrics of the collector
+func (c *Collector) Reload(config config.Config) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.apply(config)
+}
+
+func (c *Collector) apply(config config.Config) {
+	commonLabels := config.PrusaLink.CommonLabels
+	if len(commonLabels) == 0 {
+		commonLabels = []string{"printer_address", "printer_model", "printer_name", "printer_job_name", "printer_job_path"}
+	}
+	c.configuration = config
+	c.commonLabels = commonLabels
+	c.metricDesc = map[buddy.MetricName]*prometheus.Desc{}
+	c.metricDisabled = map[buddy.MetricName]bool{}
+
+	for _, m := range metrics {
+		c.metricDesc[m.Name] = prometheus.NewDesc(string(m.Name), m.Description, slices.Concat(commonLabels, m.Labels), nil)
+	}
+	for _, m := range sharedMetrics {
+		c.metricDesc[m] = buddy.NewDesc(m, commonLabels)
+	}
+
+	for _, m := range config.PrusaLink.DisableMetrics {
+		c.metricDisabled[buddy.MetricName(m)] = true
+	}
+
+	c.updatePollers(config)
+}
+
+// updatePollers starts pollers for new or changed Einsy printers and stops pollers of removed ones
+func (c *Collector) updatePollers(config config.Config) {
+	interval := buddy.PollInterval(config)
+
+	pollers := make(map[string]*poller)
+	for _, printer := range config.Printers {
+		if printer.GetBoard() != "einsy" {
+			continue
+		}
+		if p, ok := c.pollers[printer.Address]; ok && p.printer == printer && p.interval == interval {
+			pollers[printer.Address] = p
+			delete(c.pollers, printer.Address)
+			continue
+		}
+		p := newPoller(printer, interval)
+		pollers[printer.Address] = p
+		go p.run()
+	}
+
+	for _, p := range c.pollers {
+		p.close()
+		buddy.ForgetPrinter(p.printer)
+	}
+	c.pollers = pollers
+}
+
+// Describe implements prometheus.Collector. Einsy metrics are unchecked, the shared ones are already
+// described by the Buddy collector and registry rejects a descriptor described twice.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {}
+
+// Collect implements prometheus.Collector
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, s := range c.configuration.Printers {
+		if s.GetBoard() != "einsy" {
+			continue
+		}
+
+		var snap *snapshot
+		if p, ok := c.pollers[s.Address]; ok {
+			snap = p.snapshot()
+		}
+
+		if snap == nil {
+			ch <- prometheus.MustNewConstMetric(c.metricDesc[buddy.MetricPrinterUp], prometheus.GaugeValue,
+				0, s.Address, s.Type, s.Name)
+			continue
+		}
+
+		c.collectSnapshot(ch, snap)
+	}
+}
+
+// collectSnapshot sends metrics of a single Einsy printer snapshot
+func (c *Collector) collectSnapshot(ch chan<- prometheus.Metric, snap *snapshot) {
+	s := snap.printer
+	job, printer, version, status, info := snap.job, snap.printerData, snap.version, snap.status, snap.info
+
+	if c.metricEnabled(buddy.MetricPrinterSnapshotAge) {
+		ch <- prometheus.MustNewConstMetric(c.metricDesc[buddy.MetricPrinterSnapshotAge], prometheus.GaugeValue,
+			time.Since(snap.time).Seconds(), s.Address, s.Type, s.Name)
+	}
+
+	if !snap.up {
+		ch <- prometheus.MustNewConstMetric(c.metricDesc[buddy.MetricPrinterUp], prometheus.GaugeValue,
+			0, s.Address, s.Type, s.Name)
+		return
+	}
+
+	if c.metricEnabled(buddy.MetricPrinterInfo) {
+		ch <- prometheus.MustNewConstMetric(c.metricDesc[buddy.MetricPrinterInfo], prometheus.GaugeValue,
+			1, c.GetLabels(s, job, version.API, version.Server, version.Text, info.Name, info.Location, info.Serial, info.Hostname)...)
+	}
+
+	if c.metricEnabled(buddy.MetricPrinterCurrentJob) {
+		value := float64(1)
+		if job.Job.File.Name == "" {
+			value = 0
+		}
+		ch <- prometheus.MustNewConstMetric(c.metricDesc[buddy.MetricPrinterCurrentJob], prometheus.GaugeValue,
+			value, s.Address, s.Type, s.Name, job.Job.File.Name, job.Job.File.Path)
+	}
+
+	if c.metricEnabled(buddy.MetricPrinterStatus) {
+		ch <- prometheus.MustNewConstMetric(c.metricDesc[buddy.MetricPrinterStatus], prometheus.GaugeValue,
+			buddy.GetStateFlag(printer.Printer), c.GetLabels(s, job, printer.State.Text)...)
+	}
+
+	if c.metricEnabled(buddy.MetricPrinterTemp) {
+		ch <- prometheus.MustNewConstMetric(c.metricDesc[buddy.MetricPrinterTemp], prometheus.GaugeValue,
+			printer.Temperature.Bed.Actual, c.GetLabels(s, job, "bed")...)
+		ch <- prometheus.MustNewConstMetric(c.metricDesc[buddy.MetricPrinterTemp], prometheus.GaugeValue,
+			printer.Temperature.Tool0.Actual, c.GetLabels(s, job, "tool0")...)
+	}
+
+	if c.metricEnabled(buddy.MetricPrinterTempTarget) {
+		ch <- prometheus.MustNewConstMetric(c.metricDesc[buddy.MetricPrinterTempTarget], prometheus.GaugeValue,
+			printer.Temperature.Bed.Target, c.GetLabels(s, job, "bed")...)
+		ch <- prometheus.MustNewConstMetric(c.metricDesc[buddy.MetricPrinterTempTarget], prometheus.GaugeValue,
+			printer.Temperature.Tool0.Target, c.GetLabels(s, job, "tool0")...)
+	}
+
+	if c.metricEnabled(buddy.MetricPrinterFanSpeedRpm) {
+		ch <- prometheus.MustNewConstMetric(c.metricDesc[buddy.MetricPrinterFanSpeedRpm], prometheus.GaugeValue,
+			status.Printer.FanHotend, c.GetLabels(s, job, "hotend")...)
+		ch <- prometheus.MustNewConstMetric(c.metricDesc[buddy.MetricPrinterFanSpeedRpm], prometheus.GaugeValue,
+			status.Printer.FanPrint, c.GetLabels(s, job, "print")...)
+	}
+
+	if c.metricEnabled(buddy.MetricPrinterNozzleSize) {
+		ch <- prometheus.MustNewConstMetric(c.metricDesc[buddy.MetricPrinterNozzleSize], prometheus.GaugeValue,
+			info.NozzleDiameter, c.GetLabels(s, job)...)
+	}
+
+	if c.metricEnabled(buddy.MetricPrinterPrintSpeedRatio) {
+		ch <- prometheus.MustNewConstMetric(c.metricDesc[buddy.MetricPrinterPrintSpeedRatio], prometheus.GaugeValue,
+			printer.Telemetry.PrintSpeed/100, c.GetLabels(s, job)...)
+	}
+
+	if c.metricEnabled(buddy.MetricPrinterPrintTime) {
+		ch <- prometheus.MustNewConstMetric(c.metricDesc[buddy.MetricPrinterPrintTime], prometheus.GaugeValue,
+			job.Progress.PrintTime, c.GetLabels(s, job)...)
+	}
+
+	if c.metricEnabled(buddy.MetricPrinterPrintTimeRemaining) {
+		ch <- prometheus.MustNewConstMetric(c.metricDesc[buddy.MetricPrinterPrintTimeRemaining], prometheus.GaugeValue,
+			job.Progress.PrintTimeLeft, c.GetLabels(s, job)...)
+	}
+
+	if c.metricEnabled(buddy.MetricPrinterPrintProgressRatio) {
+		ch <- prometheus.MustNewConstMetric(c.metricDesc[buddy.MetricPrinterPrintProgressRatio], prometheus.GaugeValue,
+			job.Progress.Completion, c.GetLabels(s, job)...)
+	}
+
+	if c.metricEnabled(buddy.MetricPrinterMaterial) {
+		material := strings.TrimSpace(printer.Telemetry.Material)
+		ch <- prometheus.MustNewConstMetric(c.metricDesc[buddy.MetricPrinterMaterial], prometheus.GaugeValue,
+			buddy.BoolToFloat(!strings.Contains(material, "-")), c.GetLabels(s, job, material)...)
+	}
+
+	// PrusaLink on Raspberry Pi knows only position of Z axis
+	if c.metricEnabled(buddy.MetricPrinterAxis) {
+		ch <- prometheus.MustNewConstMetric(c.metricDesc[buddy.MetricPrinterAxis], prometheus.GaugeValue,
+			printer.Telemetry.AxisZ, c.GetLabels(s, job, "z")...)
+	}
+
+	if c.metricEnabled(buddy.MetricPrinterFlow) {
+		ch <- prometheus.MustNewConstMetric(c.metricDesc[buddy.MetricPrinterFlow], prometheus.GaugeValue,
+			status.Printer.Flow/100, c.GetLabels(s, job)...)
+	}
+
+	for name, storage := range map[string]*Storage{"local": printer.Storage.Local, "sd_card": printer.Storage.SDCard} {
+		if storage == nil {
+			continue
+		}
+		if c.metricEnabled(buddy.MetricPrinterStorageFree) {
+			ch <- prometheus.MustNewConstMetric(c.metricDesc[buddy.MetricPrinterStorageFree], prometheus.GaugeValue,
+				storage.FreeSpace, c.GetLabels(s, job, name)...)
+		}
+		if c.metricEnabled(buddy.MetricPrinterStorageTotal) {
+			ch <- prometheus.MustNewConstMetric(c.metricDesc[buddy.MetricPrinterStorageTotal], prometheus.GaugeValue,
+				storage.TotalSpace, c.GetLabels(s, job, name)...)
+		}
+	}
+
+	if c.metricEnabled(MetricPrinterLinkOk) && status.Printer.State != "" {
+		ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterLinkOk], prometheus.GaugeValue,
+			buddy.BoolToFloat(status.Printer.StatusConnect.Ok), c.GetLabels(s, job, "connect", status.Printer.StatusConnect.Message)...)
+		ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterLinkOk], prometheus.GaugeValue,
+			buddy.BoolToFloat(status.Printer.StatusPrinter.Ok), c.GetLabels(s, job, "printer", status.Printer.StatusPrinter.Message)...)
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.metricDesc[buddy.MetricPrinterUp], prometheus.GaugeValue,
+		1, s.Address, s.Type, s.Name)
+}
+
+// GetLabels is used to get the labels for the given printer and job
+func (c *Collector) GetLabels(printer config.Printers, job buddy.Job, labelValues ...string) []string {
+	commonValues := make([]string, len(c.commonLabels), len(c.commonLabels)+len(labelValues))
+
+	for i, l := range c.commonLabels {
+		switch l {
+		case "printer_address":
+			commonValues[i] = printer.Address
+		case "printer_model":
+			commonValues[i] = printer.Type
+		case "printer_name":
+			commonValues[i] = printer.Name
+		case "printer_job_name":
+			commonValues[i] = job.Job.File.Name
+		case "printer_job_path":
+			commonValues[i] = job.Job.File.Path
+		}
+	}
+	return append(commonValues, labelValues...)
+}
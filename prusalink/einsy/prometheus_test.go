@@ -0,0 +1,121 @@
+package prusalink
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/pstrobl96/prusa_exporter/config"
+	buddy "github.com/pstrobl96/prusa_exporter/prusalink/buddy"
+)
+
+func newFakeEinsy(t *testing.T) *httptest.Server {
+	t.Helper()
+	endpoints := map[string]string{
+		"/api/job":       "job.json",
+		"/api/printer":   "printer.json",
+		"/api/version":   "version.json",
+		"/api/v1/status": "v1/status.json",
+		"/api/v1/info":   "v1/info.json",
+	}
+	responses := map[string][]byte{}
+	for path, file := range endpoints {
+		data, err := os.ReadFile("../api/einsy/" + file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		responses[path] = data
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := responses[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	}))
+}
+
+func TestCollector(t *testing.T) {
+	server := newFakeEinsy(t)
+	defer server.Close()
+	address := strings.TrimPrefix(server.URL, "http://")
+
+	var cfg config.Config
+	cfg.PrusaLink.CommonLabels = []string{"printer_name"}
+	cfg.Printers = []config.Printers{
+		{Address: address, Name: "mk3s", Type: "I3MK3S", Apikey: "key"},
+		{Address: "10.0.0.1", Name: "mk4", Type: "MK4"},
+	}
+
+	c := NewCollector(cfg)
+	defer c.Reload(config.Config{})
+
+	if len(c.pollers) != 1 {
+		t.Errorf("expected only the Einsy printer to be polled, got %d pollers", len(c.pollers))
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for c.pollers[address].snapshot() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("printer was not polled")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	expected := `
+# HELP prusa_axis Returns information about position of axis.
+# TYPE prusa_axis gauge
+prusa_axis{printer_axis="z",printer_name="mk3s"} 0.4
+# HELP prusa_fan_speed_rpm Returns information about speed of hotend fan in rpm.
+# TYPE prusa_fan_speed_rpm gauge
+prusa_fan_speed_rpm{fan="hotend",printer_name="mk3s"} 4080
+prusa_fan_speed_rpm{fan="print",printer_name="mk3s"} 0
+# HELP prusa_link_ok Returns 1 if PrusaLink reports the service as working.
+# TYPE prusa_link_ok gauge
+prusa_link_ok{printer_link_message="Connect isn't configured",printer_link_service="connect",printer_name="mk3s"} 1
+prusa_link_ok{printer_link_message="OK",printer_link_service="printer",printer_name="mk3s"} 1
+# HELP prusa_material_info Returns information about loaded filament. Returns 0 if there is no loaded filament
+# TYPE prusa_material_info gauge
+prusa_material_info{printer_filament="-",printer_name="mk3s"} 0
+# HELP prusa_print_flow_ratio Returns information about of filament flow in ratio (0.0 - 1.0).
+# TYPE prusa_print_flow_ratio gauge
+prusa_print_flow_ratio{printer_name="mk3s"} 0.95
+# HELP prusa_status_info Returns information status of printer.
+# TYPE prusa_status_info gauge
+prusa_status_info{printer_name="mk3s",printer_state="Printing"} 4
+# HELP prusa_storage_free_bytes Returns free space of the storage in bytes.
+# TYPE prusa_storage_free_bytes gauge
+prusa_storage_free_bytes{printer_name="mk3s",printer_storage="local"} 2.7429453824e+10
+# HELP prusa_storage_total_bytes Returns total space of the storage in bytes.
+# TYPE prusa_storage_total_bytes gauge
+prusa_storage_total_bytes{printer_name="mk3s",printer_storage="local"} 3.032313856e+10
+# HELP prusa_up Return information about online printers. If printer is registered as offline then returned value is 0.
+# TYPE prusa_up gauge
+prusa_up{printer_address="` + address + `",printer_model="I3MK3S",printer_name="mk3s"} 1
+`
+	err := testutil.CollectAndCompare(c, strings.NewReader(expected),
+		"prusa_axis", "prusa_fan_speed_rpm", "prusa_link_ok", "prusa_material_info", "prusa_print_flow_ratio",
+		"prusa_status_info", "prusa_storage_free_bytes", "prusa_storage_total_bytes", "prusa_up")
+	if err != nil {
+		t.Error(err)
+	}
+
+	// shared metrics are described once, by the Buddy collector
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(buddy.NewCollector(config.Config{PrusaLink: cfg.PrusaLink})); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Register(c); err != nil {
+		t.Errorf("Einsy collector next to Buddy collector: %v", err)
+	}
+	if _, err := registry.Gather(); err != nil {
+		t.Error(err)
+	}
+}
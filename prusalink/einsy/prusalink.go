@@ -0,0 +1,22 @@
+package prusalink
+
+import (
+	"github.com/pstrobl96/prusa_exporter/config"
+	buddy "github.com/pstrobl96/prusa_exporter/prusalink/buddy"
+)
+
+// GetPrinter is used to get the Einsy printer's printer API endpoint
+func GetPrinter(printer config.Printers) (Printer, error) {
+	var printerData Printer
+	err := buddy.GetEndpoint("/api/printer", printer, &printerData)
+
+	return printerData, err
+}
+
+// GetStatus is used to get the Einsy printer's status API endpoint
+func GetStatus(printer config.Printers) (Status, error) {
+	var status Status
+	err := buddy.GetEndpoint("/api/v1/status", printer, &status)
+
+	return status, err
+}
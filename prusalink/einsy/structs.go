@@ -0,0 +1,55 @@
+package prusalink
+
+import buddy "github.com/pstrobl96/prusa_exporter/prusalink/buddy"
+
+// Printer is a struct that contains data about the printer from path /api/printer.
+// PrusaLink on Raspberry Pi adds storage and sends null for unknown axes.
+type Printer struct {
+	buddy.Printer
+	Storage struct {
+		Local  *Storage `json:"local"`
+		SDCard *Storage `json:"sd_card"`
+	} `json:"storage"`
+}
+
+// Storage is a struct that contains size of a storage in bytes
+type Storage struct {
+	FreeSpace  float64 `json:"free_space"`
+	TotalSpace float64 `json:"total_space"`
+}
+
+// Status is a struct that returns /api/v1/status endpoint in the Einsy schema - storage is a list
+// and printer reports state of its services
+type Status struct {
+	Storage []struct {
+		Path      string  `json:"path"`
+		Name      string  `json:"name"`
+		ReadOnly  bool    `json:"read_only"`
+		FreeSpace float64 `json:"free_space"`
+	} `json:"storage"`
+	Job struct {
+		ID            float64 `json:"id"`
+		Progress      float64 `json:"progress"`
+		TimeRemaining float64 `json:"time_remaining"`
+	} `json:"job"`
+	Printer struct {
+		State         string        `json:"state"`
+		TempBed       float64       `json:"temp_bed"`
+		TargetBed     float64       `json:"target_bed"`
+		TempNozzle    float64       `json:"temp_nozzle"`
+		TargetNozzle  float64       `json:"target_nozzle"`
+		AxisZ         float64       `json:"axis_z"`
+		Flow          float64       `json:"flow"`
+		Speed         float64       `json:"speed"`
+		FanHotend     float64       `json:"fan_hotend"`
+		FanPrint      float64       `json:"fan_print"`
+		StatusConnect ServiceStatus `json:"status_connect"`
+		StatusPrinter ServiceStatus `json:"status_printer"`
+	} `json:"printer"`
+}
+
+// ServiceStatus is a state of PrusaLink service reported in /api/v1/status
+type ServiceStatus struct {
+	Ok      bool   `json:"ok"`
+	Message string `json:"message"`
+}
@@ -1,3 +1,274 @@
 package prusalink
 
-// dummy
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/pstrobl96/prusa_exporter/config"
+	buddy "github.com/pstrobl96/prusa_exporter/prusalink/buddy"
+)
+
+// Collector is a struct of all SL printer metrics
+type Collector struct {
+	mu sync.RWMutex
+
+	metricDesc     map[buddy.MetricName]*prometheus.Desc
+	metricDisabled map[buddy.MetricName]bool
+
+	configuration config.Config
+	commonLabels  []string
+
+	pollers map[string]*poller
+}
+
+const (
+	MetricPrinterCoverClosed     buddy.MetricName = "prusa_cover_closed"
+	MetricPrinterExposureTime    buddy.MetricName = "prusa_exposure_time_seconds"
+	MetricPrinterPrintLayer      buddy.MetricName = "prusa_print_layer"
+	MetricPrinterPrintLayerCount buddy.MetricName = "prusa_print_layers"
+)
+
+type metricDesc struct {
+	Name        buddy.MetricName
+	Description string
+	Labels      []string
+}
+
+// metrics exposed only by SL printers
+var metrics = []metricDesc{
+	{MetricPrinterCoverClosed, "Returns 1 if the cover of SL printer is closed.", nil},
+	{MetricPrinterExposureTime, "Returns exposure time of layers of current print in seconds.", []string{"printer_exposure"}},
+	{MetricPrinterPrintLayer, "Returns number of the layer that is being printed.", nil},
+	{MetricPrinterPrintLayerCount, "Returns number of layers of current print.", nil},
+}
+
+// sharedMetrics have the same meaning for SL printers, their descriptors are taken from the Buddy collector
+var sharedMetrics = []buddy.MetricName{
+	buddy.MetricPrinterUp,
+	buddy.MetricPrinterSnapshotAge,
+	buddy.MetricPrinterCurrentJob,
+	buddy.MetricPrinterInfo,
+	buddy.MetricPrinterStatus,
+	buddy.MetricPrinterTemp,
+	buddy.MetricPrinterFanSpeedRpm,
+	buddy.MetricPrinterPrintTime,
+	buddy.MetricPrinterPrintTimeRemaining,
+	buddy.MetricPrinterPrintProgressRatio,
+	buddy.MetricPrinterLayerHeight,
+}
+
+func (c *Collector) metricEnabled(m buddy.MetricName) bool {
+	return !c.metricDisabled[m]
+}
+
+// NewCollector returns a new Collector for SL printer metrics
+func NewCollector(config config.Config) *Collector {
+	c := &Collector{}
+	c.apply(config)
+	return c
+}
+
+// Reload swaps the printer list, common labels and disabled metrics of the collector
+func (c *Collector) Reload(config config.Config) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.apply(config)
+}
+
+func (c *Collector) apply(config config.Config) {
+	commonLabels := config.PrusaLink.CommonLabels
+	if len(commonLabels) == 0 {
+		commonLabels = []string{"printer_address", "printer_model", "printer_name", "printer_job_name", "printer_job_path"}
+	}
+	c.configuration = config
+	c.commonLabels = commonLabels
+	c.metricDesc = map[buddy.MetricName]*prometheus.Desc{}
+	c.metricDisabled = map[buddy.MetricName]bool{}
+
+	for _, m := range metrics {
+		c.metricDesc[m.Name] = prometheus.NewDesc(string(m.Name), m.Description, slices.Concat(commonLabels, m.Labels), nil)
+	}
+	for _, m := range sharedMetrics {
+		c.metricDesc[m] = buddy.NewDesc(m, commonLabels)
+	}
+
+	for _, m := range config.PrusaLink.DisableMetrics {
+		c.metricDisabled[buddy.MetricName(m)] = true
+	}
+
+	c.updatePollers(config)
+}
+
+// updatePollers starts pollers for new or changed SL printers and stops pollers of removed ones
+func (c *Collector) updatePollers(config config.Config) {
+	interval := buddy.PollInterval(config)
+
+	pollers := make(map[string]*poller)
+	for _, printer := range config.Printers {
+		if printer.GetBoard() != "sl" {
+			continue
+		}
+		if p, ok := c.pollers[printer.Address]; ok && p.printer == printer && p.interval == interval {
+			pollers[printer.Address] = p
+			delete(c.pollers, printer.Address)
+			continue
+		}
+		p := newPoller(printer, interval)
+		pollers[printer.Address] = p
+		go p.run()
+	}
+
+	for _, p := range c.pollers {
+		p.close()
+		buddy.ForgetPrinter(p.printer)
+	}
+	c.pollers = pollers
+}
+
+// Describe implements prometheus.Collector. SL metrics are unchecked, the shared ones are already
+// described by the Buddy collector and registry rejects a descriptor described twice.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {}
+
+// Collect implements prometheus.Collector
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, s := range c.configuration.Printers {
+		if s.GetBoard() != "sl" {
+			continue
+		}
+
+		var snap *snapshot
+		if p, ok := c.pollers[s.Address]; ok {
+			snap = p.snapshot()
+		}
+
+		if snap == nil {
+			ch <- prometheus.MustNewConstMetric(c.metricDesc[buddy.MetricPrinterUp], prometheus.GaugeValue,
+				0, s.Address, s.Type, s.Name)
+			continue
+		}
+
+		c.collectSnapshot(ch, snap)
+	}
+}
+
+// collectSnapshot sends metrics of a single SL printer snapshot
+func (c *Collector) collectSnapshot(ch chan<- prometheus.Metric, snap *snapshot) {
+	s := snap.printer
+	job, printer, version := snap.job, snap.printerData, snap.version
+
+	if c.metricEnabled(buddy.MetricPrinterSnapshotAge) {
+		ch <- prometheus.MustNewConstMetric(c.metricDesc[buddy.MetricPrinterSnapshotAge], prometheus.GaugeValue,
+			time.Since(snap.time).Seconds(), s.Address, s.Type, s.Name)
+	}
+
+	if !snap.up {
+		ch <- prometheus.MustNewConstMetric(c.metricDesc[buddy.MetricPrinterUp], prometheus.GaugeValue,
+			0, s.Address, s.Type, s.Name)
+		return
+	}
+
+	if c.metricEnabled(buddy.MetricPrinterInfo) {
+		ch <- prometheus.MustNewConstMetric(c.metricDesc[buddy.MetricPrinterInfo], prometheus.GaugeValue,
+			1, c.GetLabels(s, job, version.API, version.Server, version.Text, "", "", "", version.Hostname)...)
+	}
+
+	if c.metricEnabled(buddy.MetricPrinterCurrentJob) {
+		value := float64(1)
+		if job.Job.File.Name == "" {
+			value = 0
+		}
+		ch <- prometheus.MustNewConstMetric(c.metricDesc[buddy.MetricPrinterCurrentJob], prometheus.GaugeValue,
+			value, s.Address, s.Type, s.Name, job.Job.File.Name, job.Job.File.Path)
+	}
+
+	if c.metricEnabled(buddy.MetricPrinterStatus) {
+		ch <- prometheus.MustNewConstMetric(c.metricDesc[buddy.MetricPrinterStatus], prometheus.GaugeValue,
+			buddy.GetStateFlag(printer), c.GetLabels(s, job, printer.State.Text)...)
+	}
+
+	if c.metricEnabled(buddy.MetricPrinterTemp) {
+		for element, value := range map[string]float64{
+			"uv_led":  printer.Telemetry.TempUvLed,
+			"cpu":     printer.Telemetry.TempCPU,
+			"ambient": printer.Telemetry.TempAmbient,
+		} {
+			ch <- prometheus.MustNewConstMetric(c.metricDesc[buddy.MetricPrinterTemp], prometheus.GaugeValue,
+				value, c.GetLabels(s, job, element)...)
+		}
+	}
+
+	if c.metricEnabled(buddy.MetricPrinterFanSpeedRpm) {
+		for fan, value := range map[string]float64{
+			"uv_led": printer.Telemetry.FanUvLed,
+			"blower": printer.Telemetry.FanBlower,
+			"rear":   printer.Telemetry.FanRear,
+		} {
+			ch <- prometheus.MustNewConstMetric(c.metricDesc[buddy.MetricPrinterFanSpeedRpm], prometheus.GaugeValue,
+				value, c.GetLabels(s, job, fan)...)
+		}
+	}
+
+	if c.metricEnabled(MetricPrinterCoverClosed) {
+		ch <- prometheus.MustNewConstMetric(c.metricDesc[MetricPrinterCoverClosed], prometheus.GaugeValue,
+			buddy.BoolToFloat(printer.Telemetry.CoverClosed), c.GetLabels(s, job)...)
+	}
+
+	if c.metricEnabled(buddy.MetricPrinterPrintTime) {
+		ch <- prometheus.MustNewConstMetric(c.metricDesc[buddy.MetricPrinterPrintTime], prometheus.GaugeValue,
+			job.Progress.PrintTime, c.GetLabels(s, job)...)
+	}
+
+	if c.metricEnabled(buddy.MetricPrinterPrintTimeRemaining) {
+		ch <- prometheus.MustNewConstMetric(c.metricDesc[buddy.MetricPrinterPrintTimeRemaining], prometheus.GaugeValue,
+			job.Progress.PrintTimeLeft, c.GetLabels(s, job)...)
+	}
+
+	if c.metricEnabled(buddy.MetricPrinterPrintProgressRatio) {
+		ch <- prometheus.MustNewConstMetric(c.metricDesc[buddy.MetricPrinterPrintProgressRatio], prometheus.GaugeValue,
+			job.Progress.Completion, c.GetLabels(s, job)...)
+	}
+
+	// Fields below are sent by the printer only while printing
+	c.collectOptional(ch, MetricPrinterPrintLayer, job.Progress.CurrentLayer, 1, c.GetLabels(s, job))
+	c.collectOptional(ch, MetricPrinterPrintLayerCount, job.Job.Layers, 1, c.GetLabels(s, job))
+	c.collectOptional(ch, buddy.MetricPrinterLayerHeight, job.Job.LayerHeight, 0.001, c.GetLabels(s, job))
+	c.collectOptional(ch, MetricPrinterExposureTime, job.Job.ExposureTimeFirst, 1, c.GetLabels(s, job, "first"))
+	c.collectOptional(ch, MetricPrinterExposureTime, job.Job.ExposureTime, 1, c.GetLabels(s, job, "layer"))
+
+	ch <- prometheus.MustNewConstMetric(c.metricDesc[buddy.MetricPrinterUp], prometheus.GaugeValue,
+		1, s.Address, s.Type, s.Name)
+}
+
+// collectOptional sends the metric multiplied by scale if the value was sent by the printer
+func (c *Collector) collectOptional(ch chan<- prometheus.Metric, name buddy.MetricName, value *float64, scale float64, labels []string) {
+	if value == nil || !c.metricEnabled(name) {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.metricDesc[name], prometheus.GaugeValue, *value*scale, labels...)
+}
+
+// GetLabels is used to get the labels for the given printer and job
+func (c *Collector) GetLabels(printer config.Printers, job Job, labelValues ...string) []string {
+	commonValues := make([]string, len(c.commonLabels), len(c.commonLabels)+len(labelValues))
+
+	for i, l := range c.commonLabels {
+		switch l {
+		case "printer_address":
+			commonValues[i] = printer.Address
+		case "printer_model":
+			commonValues[i] = printer.Type
+		case "printer_name":
+			commonValues[i] = printer.Name
+		case "printer_job_name":
+			commonValues[i] = job.Job.File.Name
+		case "printer_job_path":
+			commonValues[i] = job.Job.File.Path
+		}
+	}
+	return append(commonValues, labelValues...)
+}
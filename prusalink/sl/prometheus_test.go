@@ -0,0 +1,160 @@
+package prusalink
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/pstrobl96/prusa_exporter/config"
+	buddy "github.com/pstrobl96/prusa_exporter/prusalink/buddy"
+)
+
+// newFakeSL serves the job and printer fixtures from ../api/sl
+func newFakeSL(t *testing.T, jobFixture string, printerFixture string) *httptest.Server {
+	t.Helper()
+	job, err := os.ReadFile("../api/sl/" + jobFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	printer, err := os.ReadFile("../api/sl/" + printerFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, err := os.ReadFile("../api/sl/version.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/job":
+			w.Write(job)
+		case "/api/printer":
+			w.Write(printer)
+		case "/api/version":
+			w.Write(version)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func collectPrinter(t *testing.T, server *httptest.Server) *Collector {
+	t.Helper()
+	var cfg config.Config
+	cfg.Printers = []config.Printers{
+		{Address: strings.TrimPrefix(server.URL, "http://"), Name: "sl1s", Type: "SL1S", Apikey: "key"},
+		{Address: "10.0.0.1", Name: "mk4", Type: "MK4"},
+	}
+
+	c := NewCollector(cfg)
+	t.Cleanup(func() { c.Reload(config.Config{}) })
+
+	deadline := time.Now().Add(5 * time.Second)
+	for c.pollers[cfg.Printers[0].Address].snapshot() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("printer was not polled")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return c
+}
+
+func TestCollectorPrinting(t *testing.T) {
+	server := newFakeSL(t, "job_printing.json", "printer_printing.json")
+	defer server.Close()
+	c := collectPrinter(t, server)
+
+	if len(c.pollers) != 1 {
+		t.Errorf("expected only the SL printer to be polled, got %d pollers", len(c.pollers))
+	}
+
+	address := strings.TrimPrefix(server.URL, "http://")
+	job := `printer_job_name="Resin_Calibration_Object_0.100.sl1",printer_job_path="examples/Calibration objects/Resin_Calibration_Object_0.100.sl1"`
+	labels := `printer_address="` + address + `",` + job + `,printer_model="SL1S",printer_name="sl1s"`
+	// labels of series are sorted by name
+	with := func(name, value string) string {
+		return `printer_address="` + address + `",` + name + `="` + value + `",` + job + `,printer_model="SL1S",printer_name="sl1s"`
+	}
+	withFan := func(fan string) string {
+		return `fan="` + fan + `",printer_address="` + address + `",` + job + `,printer_model="SL1S",printer_name="sl1s"`
+	}
+	expected := `
+# HELP prusa_exposure_time_seconds Returns exposure time of layers of current print in seconds.
+# TYPE prusa_exposure_time_seconds gauge
+prusa_exposure_time_seconds{` + with("printer_exposure", "first") + `} 35
+prusa_exposure_time_seconds{` + with("printer_exposure", "layer") + `} 2.5
+# HELP prusa_layer_height_meters Returns layer height of current print in meters.
+# TYPE prusa_layer_height_meters gauge
+prusa_layer_height_meters{` + labels + `} 0.0001
+# HELP prusa_print_layer Returns number of the layer that is being printed.
+# TYPE prusa_print_layer gauge
+prusa_print_layer{` + labels + `} 45
+# HELP prusa_print_layers Returns number of layers of current print.
+# TYPE prusa_print_layers gauge
+prusa_print_layers{` + labels + `} 185
+# HELP prusa_printing_progress_ratio Returns information about completion of current print in ratio (0.0-1.0)
+# TYPE prusa_printing_progress_ratio gauge
+prusa_printing_progress_ratio{` + labels + `} 0.2432
+# HELP prusa_cover_closed Returns 1 if the cover of SL printer is closed.
+# TYPE prusa_cover_closed gauge
+prusa_cover_closed{` + labels + `} 1
+# HELP prusa_fan_speed_rpm Returns information about speed of hotend fan in rpm.
+# TYPE prusa_fan_speed_rpm gauge
+prusa_fan_speed_rpm{` + withFan("blower") + `} 1980
+prusa_fan_speed_rpm{` + withFan("rear") + `} 1200
+prusa_fan_speed_rpm{` + withFan("uv_led") + `} 2640
+# HELP prusa_temperature_celsius Current temp of printer in Celsius
+# TYPE prusa_temperature_celsius gauge
+prusa_temperature_celsius{` + with("printer_heated_element", "ambient") + `} 26.8
+prusa_temperature_celsius{` + with("printer_heated_element", "cpu") + `} 58.4
+prusa_temperature_celsius{` + with("printer_heated_element", "uv_led") + `} 41.2
+# HELP prusa_status_info Returns information status of printer.
+# TYPE prusa_status_info gauge
+prusa_status_info{` + labels + `,printer_state="Printing"} 4
+# HELP prusa_up Return information about online printers. If printer is registered as offline then returned value is 0.
+# TYPE prusa_up gauge
+prusa_up{printer_address="` + address + `",printer_model="SL1S",printer_name="sl1s"} 1
+`
+	// prusa_up of the MK4 is collected by the Buddy collector, printing state wins over operational
+	err := testutil.CollectAndCompare(c, strings.NewReader(expected),
+		"prusa_exposure_time_seconds", "prusa_layer_height_meters", "prusa_print_layer", "prusa_print_layers",
+		"prusa_printing_progress_ratio", "prusa_cover_closed", "prusa_fan_speed_rpm", "prusa_temperature_celsius",
+		"prusa_status_info", "prusa_up")
+	if err != nil {
+		t.Error(err)
+	}
+
+	// shared metrics are described once, by the Buddy collector
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(buddy.NewCollector(config.Config{})); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Register(c); err != nil {
+		t.Errorf("SL collector next to Buddy collector: %v", err)
+	}
+	if _, err := registry.Gather(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCollectorIdle(t *testing.T) {
+	server := newFakeSL(t, "job.json", "printer.json")
+	defer server.Close()
+	c := collectPrinter(t, server)
+
+	// Exposure and layer metrics are not sent by idle printer
+	for _, name := range []string{"prusa_exposure_time_seconds", "prusa_print_layer", "prusa_print_layers"} {
+		if count := testutil.CollectAndCount(c, name); count != 0 {
+			t.Errorf("%s: expected no series of idle printer, got %d", name, count)
+		}
+	}
+	if count := testutil.CollectAndCount(c, "prusa_fan_speed_rpm"); count != 3 {
+		t.Errorf("prusa_fan_speed_rpm: expected 3 fans, got %d", count)
+	}
+}
@@ -1,3 +1,14 @@
 package prusalink
 
-// dummy
+import (
+	"github.com/pstrobl96/prusa_exporter/config"
+	buddy "github.com/pstrobl96/prusa_exporter/prusalink/buddy"
+)
+
+// GetJob is used to get the SL printer's job API endpoint
+func GetJob(printer config.Printers) (Job, error) {
+	var job Job
+	err := buddy.GetEndpoint("/api/job", printer, &job)
+
+	return job, err
+}
@@ -1,3 +1,29 @@
 package prusalink
 
-// dummy
+// Job is a struct that contains data about print job of SL printer.
+// Exposure and layer fields are sent only while printing, so they are pointers.
+type Job struct {
+	State string `json:"state"`
+	Job   struct {
+		EstimatedPrintTime float64 `json:"estimatedPrintTime"`
+		File               struct {
+			Name    string  `json:"name"`
+			Path    string  `json:"path"`
+			Display string  `json:"display"`
+			Size    float64 `json:"size"`
+			Origin  string  `json:"origin"`
+			Date    float64 `json:"date"`
+		} `json:"file"`
+		ExposureTime      *float64 `json:"exposureTime"`      // seconds
+		ExposureTimeFirst *float64 `json:"exposureTimeFirst"` // seconds
+		LayerHeight       *float64 `json:"layerHeight"`       // millimeters
+		Layers            *float64 `json:"layers"`
+		Material          string   `json:"material"`
+	} `json:"job"`
+	Progress struct {
+		PrintTimeLeft float64  `json:"printTimeLeft"`
+		Completion    float64  `json:"completion"`
+		PrintTime     float64  `json:"printTime"`
+		CurrentLayer  *float64 `json:"currentLayer"`
+	} `json:"progress"`
+}
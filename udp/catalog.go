@@ -0,0 +1,106 @@
+package udp
+
+import (
+	_ "embed"
+	"fmt"
+	"maps"
+	"sync/atomic"
+
+	"github.com/pstrobl96/prusa_exporter/config"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed catalog.yml
+var builtinCatalog []byte
+
+// catalog maps metric names used by the printer to rules how they are exported
+var catalog atomic.Pointer[map[string]config.MetricRule]
+
+// SetCatalog sets rules used to name UDP metrics. Built-in rules are used when useBuiltin is set
+// and rules from configuration override them. It is called again on configuration reload,
+// series named by previous rules stay until they expire.
+func SetCatalog(overrides map[string]config.MetricRule, useBuiltin bool) error {
+	rules, err := newCatalog(overrides, useBuiltin)
+	if err != nil {
+		return err
+	}
+	catalog.Store(&rules)
+	return nil
+}
+
+// newCatalog merges built-in rules with the overrides and validates them
+func newCatalog(overrides map[string]config.MetricRule, useBuiltin bool) (map[string]config.MetricRule, error) {
+	rules := make(map[string]config.MetricRule)
+	if useBuiltin {
+		if err := yaml.Unmarshal(builtinCatalog, &rules); err != nil {
+			return nil, fmt.Errorf("built-in catalog: %v", err)
+		}
+	}
+	maps.Copy(rules, overrides)
+
+	for source, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			return nil, fmt.Errorf("catalog rule %s: %v", source, err)
+		}
+	}
+	return rules, nil
+}
+
+// exportedSample is a field of the point named according to the catalog
+type exportedSample struct {
+	name   string
+	help   string
+	labels map[string]string
+	value  float64
+}
+
+// describeField returns name, help and labels of the field of the point.
+// Without a catalog rule it is prefixed measurement, suffixed with the field unless it is v or value.
+func describeField(point point, field string, value float64) exportedSample {
+	sample := exportedSample{
+		name:   point.Measurement,
+		labels: maps.Clone(point.Tags),
+		value:  value,
+	}
+	for _, label := range printerLabels {
+		if _, ok := sample.labels[label]; !ok {
+			sample.labels[label] = "" // series of all printers have the same labels
+		}
+	}
+	source := point.Source
+	if field != "v" && field != "value" {
+		sample.name = sample.name + "_" + field
+		source = source + "_" + field
+	}
+	sample.help = "Metric for " + sample.name + " from " + point.Measurement
+
+	var rules map[string]config.MetricRule
+	if loaded := catalog.Load(); loaded != nil {
+		rules = *loaded
+	}
+	rule, ok := rules[source]
+	if !ok {
+		rule, ok = rules[point.Source]
+		if !ok || rule.FieldLabel == "" {
+			return sample
+		}
+		sample.labels[rule.FieldLabel] = field
+	}
+
+	for from, to := range rule.RenameLabels {
+		if v, ok := sample.labels[from]; ok {
+			delete(sample.labels, from)
+			sample.labels[to] = v
+		}
+	}
+	maps.Copy(sample.labels, rule.Labels)
+
+	sample.name = rule.Name
+	if rule.Help != "" {
+		sample.help = rule.Help
+	}
+	if rule.Scale != 0 {
+		sample.value = value * rule.Scale
+	}
+	return sample
+}
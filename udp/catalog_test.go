@@ -0,0 +1,61 @@
+package udp
+
+import (
+	"maps"
+	"testing"
+
+	"github.com/pstrobl96/prusa_exporter/config"
+)
+
+func TestBuiltinCatalog(t *testing.T) {
+	if err := SetCatalog(nil, true); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetCatalog(nil, false) })
+
+	if len(*catalog.Load()) == 0 {
+		t.Error("built-in catalog is empty")
+	}
+}
+
+func TestDescribeField(t *testing.T) {
+	overrides := map[string]config.MetricRule{
+		"volt_bed": {Name: "bed_millivolts", Scale: 1000},
+	}
+	if err := SetCatalog(overrides, true); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetCatalog(nil, false) })
+
+	type testCase struct {
+		Measurement string
+		Tags        map[string]string
+		Field       string
+		Name        string
+		Labels      map[string]string
+		Value       float64
+	}
+	cases := []testCase{
+		{"temp_noz", nil, "v", "prusa_nozzle_temperature_celsius", nil, 2},
+		{"volt_bed", nil, "v", "bed_millivolts", nil, 2000},
+		{"pos_z", nil, "v", "prusa_axis", map[string]string{"printer_axis": "z"}, 2},
+		{"xbe_fan", map[string]string{"fan": "1"}, "rpm", "prusa_fan_speed_rpm", map[string]string{"fan": "xbe", "fan_index": "1"}, 2},
+		{"heap", nil, "free", "prusa_heap_bytes", map[string]string{"heap": "free"}, 2},
+		{"loadcell", nil, "v", "prusa_loadcell", nil, 2},
+		{"cpu_usage", nil, "load", "prusa_cpu_usage_load", nil, 2},
+	}
+
+	for _, tc := range cases {
+		tags := map[string]string{"mac": "mac", "ip": "ip", "printer_name": "mk4"}
+		maps.Copy(tags, tc.Tags)
+		p := point{Measurement: "prusa_" + tc.Measurement, Source: tc.Measurement, Tags: tags}
+
+		got := describeField(p, tc.Field, 2)
+
+		labels := map[string]string{"mac": "mac", "ip": "ip", "printer_name": "mk4", "printer_model": ""}
+		maps.Copy(labels, tc.Labels)
+		if got.name != tc.Name || got.value != tc.Value || !maps.Equal(got.labels, labels) {
+			t.Errorf("%s %s: got %s%v %v, want %s%v %v", tc.Measurement, tc.Field, got.name, got.labels, got.value, tc.Name, labels, tc.Value)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package udp
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// tickDuration is the resolution of the printer tick counter, it is sent as tm in the message header
+	// and every line carries its offset from tm
+	tickDuration = time.Millisecond
+	// clockResync is how far the anchor may fall behind before it is moved - printer reboot or clock drift
+	clockResync = 2 * time.Second
+)
+
+var clocks = deviceClocks{
+	clocks: make(map[string]*deviceClock),
+}
+
+type deviceClocks struct {
+	mu     sync.Mutex
+	clocks map[string]*deviceClock
+}
+
+// deviceClock maps the tick counter of a printer to the wall clock
+type deviceClock struct {
+	anchor time.Time // wall clock time of tick 0
+}
+
+// sync anchors the clock of the printer with the newest ticks of a received message
+// and returns a copy of the clock usable without locking.
+func (d *deviceClocks) sync(mac string, ticks int64, received time.Time) deviceClock {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	clock, ok := d.clocks[mac]
+	if !ok {
+		clock = &deviceClock{}
+		d.clocks[mac] = clock
+	}
+
+	// Message is received after it was sent, so the lowest anchor has the smallest network delay.
+	// A much later anchor means that printer rebooted or its clock drifted away.
+	candidate := received.Add(-time.Duration(ticks) * tickDuration)
+	if !ok || candidate.Before(clock.anchor) || candidate.Sub(clock.anchor) > clockResync {
+		clock.anchor = candidate
+	}
+
+	return *clock
+}
+
+// time returns the wall clock time of the given ticks
+func (c deviceClock) time(ticks int64) time.Time {
+	return c.anchor.Add(time.Duration(ticks) * tickDuration)
+}
@@ -0,0 +1,28 @@
+package udp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeviceClock(t *testing.T) {
+	clocks := deviceClocks{clocks: make(map[string]*deviceClock)}
+	received := time.Unix(1000, 0)
+
+	clock := clocks.sync("aa", 5000, received)
+	if got := clock.time(4000); !got.Equal(received.Add(-time.Second)) {
+		t.Errorf("time(4000): got %v, want %v", got, received.Add(-time.Second))
+	}
+
+	// delayed message must not move the anchor
+	clock = clocks.sync("aa", 6000, received.Add(1500*time.Millisecond))
+	if got := clock.time(6000); !got.Equal(received.Add(time.Second)) {
+		t.Errorf("time(6000) after delay: got %v, want %v", got, received.Add(time.Second))
+	}
+
+	// printer rebooted and the tick counter started again
+	clock = clocks.sync("aa", 100, received.Add(time.Minute))
+	if got := clock.time(100); !got.Equal(received.Add(time.Minute)) {
+		t.Errorf("time(100) after reboot: got %v, want %v", got, received.Add(time.Minute))
+	}
+}
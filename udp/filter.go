@@ -0,0 +1,216 @@
+package udp
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sync/atomic"
+
+	"github.com/pstrobl96/prusa_exporter/config"
+	"github.com/rs/zerolog/log"
+)
+
+// Reasons of rejected samples in prusa_udp_rejected_samples_total
+const (
+	reasonMeasurementFiltered = "measurement_filtered"
+	reasonFieldFiltered       = "field_filtered"
+	reasonFamilyLimit         = "family_limit"
+	reasonSeriesLimit         = "series_limit"
+	reasonTotalFamilyLimit    = "total_family_limit"
+	reasonTotalSeriesLimit    = "total_series_limit"
+)
+
+var (
+	filter atomic.Pointer[sampleFilter]
+	limits config.UDPLimits                 // guarded by registryMetrics.mu
+	usage  = make(map[string]*printerUsage) // by budget key, guarded by registryMetrics.mu
+	// seriesTotal is number of series in usage, guarded by registryMetrics.mu
+	seriesTotal int
+)
+
+// rules is an allow and deny list of names
+type rules struct {
+	allow []*regexp.Regexp
+	deny  []*regexp.Regexp
+}
+
+// sampleFilter decides which measurements, fields and tags sent by printers are accepted
+type sampleFilter struct {
+	measurements rules
+	fields       rules
+	tags         rules
+}
+
+// printerUsage is the set of metric families and series exported for a single printer
+type printerUsage struct {
+	families map[string]struct{}
+	series   map[string]struct{}
+}
+
+// SetFilter sets which udp metrics are accepted and how many of them can be exported per printer.
+// It is called again on configuration reload, exported series are not removed by a stricter filter or limits.
+func SetFilter(cfg config.UDPFilter, udpLimits config.UDPLimits) error {
+	f, err := newSampleFilter(cfg)
+	if err != nil {
+		return err
+	}
+
+	filter.Store(f)
+	registryMetrics.mu.Lock()
+	limits = udpLimits
+	registryMetrics.mu.Unlock()
+	return nil
+}
+
+// CheckConfig returns error if the catalog or filter of the configuration can't be set,
+// so the reload can be rejected before anything is applied
+func CheckConfig(cfg config.Config, useBuiltinCatalog bool) error {
+	if _, err := newCatalog(cfg.UDP.Catalog, useBuiltinCatalog); err != nil {
+		return err
+	}
+	_, err := newSampleFilter(cfg.UDP.Filter)
+	return err
+}
+
+// newSampleFilter compiles the allow and deny lists of the filter
+func newSampleFilter(cfg config.UDPFilter) (*sampleFilter, error) {
+	var f sampleFilter
+	var err error
+	lists := []struct {
+		patterns []string
+		target   *[]*regexp.Regexp
+	}{
+		{cfg.AllowMeasurements, &f.measurements.allow},
+		{cfg.DenyMeasurements, &f.measurements.deny},
+		{cfg.AllowFields, &f.fields.allow},
+		{cfg.DenyFields, &f.fields.deny},
+		{cfg.AllowTags, &f.tags.allow},
+		{cfg.DenyTags, &f.tags.deny},
+	}
+	for _, list := range lists {
+		if *list.target, err = compileAnchored(list.patterns); err != nil {
+			return nil, err
+		}
+	}
+	return &f, nil
+}
+
+func compileAnchored(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid udp filter expression %s: %v", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// accepts returns true if the name is allowed, or there is no allow list, and it is not denied
+func (r rules) accepts(name string) bool {
+	if len(r.allow) > 0 && !matchAny(r.allow, name) {
+		return false
+	}
+	return !matchAny(r.deny, name)
+}
+
+func matchAny(expressions []*regexp.Regexp, name string) bool {
+	for _, re := range expressions {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterPoint removes fields and tags of the point that are not accepted and returns false
+// when nothing is left to export. Rejected fields are counted per printer.
+func filterPoint(p *point, mac string) bool {
+	f := filter.Load()
+	if f == nil {
+		f = &sampleFilter{}
+	}
+	if !f.measurements.accepts(p.Source) {
+		rejectedSamples.WithLabelValues(mac, reasonMeasurementFiltered).Add(float64(len(p.Fields)))
+		return false
+	}
+
+	for field := range p.Fields {
+		if !f.fields.accepts(field) {
+			delete(p.Fields, field)
+			rejectedSamples.WithLabelValues(mac, reasonFieldFiltered).Inc()
+		}
+	}
+
+	// tags identifying the printer are set by the exporter, only tags sent by the device are filtered
+	for tag := range p.Tags {
+		if tag == "mac" || tag == "ip" || slices.Contains(printerLabels, tag) {
+			continue
+		}
+		if !f.tags.accepts(tag) {
+			delete(p.Tags, tag)
+		}
+	}
+
+	return len(p.Fields) > 0
+}
+
+// admit returns true if the series of the printer can be exported within the limits of its budget
+// and the limits of all printers, it is remembered as used by the budget then. Budget is given by budgetKey,
+// so a sender can't get another one by changing its mac. Caller must hold registryMetrics.mu.
+func admit(mac string, budget string, name string, labelValues []string) bool {
+	if limits == (config.UDPLimits{}) {
+		return true
+	}
+
+	u, ok := usage[budget]
+	if !ok {
+		u = &printerUsage{families: make(map[string]struct{}), series: make(map[string]struct{})}
+		usage[budget] = u
+	}
+
+	key := name
+	for _, value := range labelValues {
+		key += "\xff" + value
+	}
+	if _, ok := u.series[key]; ok {
+		return true
+	}
+
+	if _, ok := registryMetrics.metrics[name]; !ok && limits.MaxFamiliesTotal > 0 && len(registryMetrics.metrics)-1 >= limits.MaxFamiliesTotal {
+		rejectedSamples.WithLabelValues(mac, reasonTotalFamilyLimit).Inc()
+		log.Debug().Msgf("Limit of %d metric families of all printers reached, %s of %s is not exported", limits.MaxFamiliesTotal, name, mac)
+		return false
+	}
+	if limits.MaxSeriesTotal > 0 && seriesTotal >= limits.MaxSeriesTotal {
+		rejectedSamples.WithLabelValues(mac, reasonTotalSeriesLimit).Inc()
+		log.Debug().Msgf("Limit of %d series of all printers reached, series of %s of %s is not exported", limits.MaxSeriesTotal, name, mac)
+		return false
+	}
+	if _, ok := u.families[name]; !ok {
+		if limits.MaxFamilies > 0 && len(u.families) >= limits.MaxFamilies {
+			rejectedSamples.WithLabelValues(mac, reasonFamilyLimit).Inc()
+			log.Debug().Msgf("Printer %s reached limit of %d metric families, %s is not exported", mac, limits.MaxFamilies, name)
+			return false
+		}
+	}
+	if limits.MaxSeries > 0 && len(u.series) >= limits.MaxSeries {
+		rejectedSamples.WithLabelValues(mac, reasonSeriesLimit).Inc()
+		log.Debug().Msgf("Printer %s reached limit of %d series, series of %s is not exported", mac, limits.MaxSeries, name)
+		return false
+	}
+
+	u.families[name] = struct{}{}
+	u.series[key] = struct{}{}
+	seriesTotal++
+	return true
+}
+
+// forgetUsage removes usage of the budget and its series from the total. Caller must hold registryMetrics.mu.
+func forgetUsage(budget string) {
+	if u, ok := usage[budget]; ok {
+		seriesTotal -= len(u.series)
+		delete(usage, budget)
+	}
+}
@@ -0,0 +1,153 @@
+package udp
+
+import (
+	"maps"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/pstrobl96/prusa_exporter/config"
+	"gopkg.in/mcuadros/go-syslog.v2/format"
+)
+
+func TestFilterPoint(t *testing.T) {
+	err := SetFilter(config.UDPFilter{
+		DenyMeasurements: []string{"tmc_.*"},
+		AllowFields:      []string{"v", "rpm"},
+		DenyTags:         []string{"serial"},
+	}, config.UDPLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetFilter(config.UDPFilter{}, config.UDPLimits{}) })
+
+	p := &point{Source: "tmc_sg", Fields: map[string]interface{}{"v": 1, "x": 2}}
+	if filterPoint(p, "filter") {
+		t.Error("denied measurement was accepted")
+	}
+	if value := testutil.ToFloat64(rejectedSamples.WithLabelValues("filter", reasonMeasurementFiltered)); value != 2 {
+		t.Errorf("measurement_filtered = %v, expected 2", value)
+	}
+
+	p = &point{
+		Source: "xbe_fan",
+		Tags:   map[string]string{"mac": "filter", "ip": "10.0.0.1", "fan": "1", "serial": "123"},
+		Fields: map[string]interface{}{"rpm": 300, "pwm": 10},
+	}
+	if !filterPoint(p, "filter") {
+		t.Fatal("allowed field was rejected")
+	}
+	if _, ok := p.Fields["pwm"]; ok || len(p.Fields) != 1 {
+		t.Errorf("expected only rpm field, got %v", p.Fields)
+	}
+	if _, ok := p.Tags["serial"]; ok || len(p.Tags) != 3 {
+		t.Errorf("expected serial tag to be dropped, got %v", p.Tags)
+	}
+	if value := testutil.ToFloat64(rejectedSamples.WithLabelValues("filter", reasonFieldFiltered)); value != 1 {
+		t.Errorf("field_filtered = %v, expected 1", value)
+	}
+
+	// identity of the printer is kept by allow list of tags
+	if err := SetFilter(config.UDPFilter{AllowTags: []string{"fan"}}, config.UDPLimits{}); err != nil {
+		t.Fatal(err)
+	}
+	p = &point{
+		Source: "xbe_fan",
+		Tags: map[string]string{"mac": "filter", "ip": "10.0.0.1", "printer_name": "mk4", "printer_model": "MK4",
+			"fan": "1", "serial": "123"},
+		Fields: map[string]interface{}{"rpm": 300},
+	}
+	if !filterPoint(p, "filter") {
+		t.Fatal("allowed field was rejected")
+	}
+	expected := map[string]string{"mac": "filter", "ip": "10.0.0.1", "printer_name": "mk4", "printer_model": "MK4", "fan": "1"}
+	if !maps.Equal(p.Tags, expected) {
+		t.Errorf("allow_tags: got tags %v, want %v", p.Tags, expected)
+	}
+
+	if err := SetFilter(config.UDPFilter{DenyTags: []string{"("}}, config.UDPLimits{}); err == nil {
+		t.Error("expected error for invalid expression")
+	}
+}
+
+func TestLimits(t *testing.T) {
+	Init(prometheus.NewRegistry(), false)
+	if err := SetFilter(config.UDPFilter{}, config.UDPLimits{MaxFamilies: 2, MaxSeries: 3}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		SetFilter(config.UDPFilter{}, config.UDPLimits{})
+		lastPush.Reset()
+	})
+
+	// the metric of the first line is processed last
+	message := "msg=1,tm=100,v=4 limit_c v=1 100\n" +
+		"limit_a v=1 100\n" +
+		"limit_b,n=1 v=1 100\n" +
+		"limit_b,n=2 v=1 100\n" +
+		"limit_a v=2 110\n" +
+		"limit_b,n=3 v=1 110"
+	process(format.LogParts{"hostname": "limits", "client": "10.0.0.2:5000", "message": message}, "prusa_")
+
+	for _, c := range []struct {
+		reason   string
+		expected float64
+	}{
+		{reasonSeriesLimit, 1},
+		{reasonFamilyLimit, 1},
+	} {
+		if value := testutil.ToFloat64(rejectedSamples.WithLabelValues("limits", c.reason)); value != c.expected {
+			t.Errorf("%s = %v, expected %v", c.reason, value, c.expected)
+		}
+	}
+	if value := testutil.ToFloat64(familiesCreated.WithLabelValues("limits")); value != 2 {
+		t.Errorf("families created = %v, expected 2", value)
+	}
+
+	// limits are per printer
+	process(format.LogParts{"hostname": "other", "client": "10.0.0.3:5000", "message": "msg=1,tm=100,v=4 limit_c v=1 100"}, "prusa_")
+	if value := testutil.ToFloat64(familiesCreated.WithLabelValues("other")); value != 1 {
+		t.Errorf("families created by other printer = %v, expected 1", value)
+	}
+
+	// budget is kept by the address, not by the mac chosen by the sender
+	process(format.LogParts{"hostname": "rotated", "client": "10.0.0.2:5000", "message": "msg=1,tm=100,v=4 limit_b,n=4 v=1 100"}, "prusa_")
+	if value := testutil.ToFloat64(rejectedSamples.WithLabelValues("rotated", reasonSeriesLimit)); value != 1 {
+		t.Errorf("series_limit of rotated mac = %v, expected 1", value)
+	}
+
+	// budget of expired printer is forgotten
+	liveness.mu.Lock()
+	for id := range liveness.seen {
+		liveness.seen[id] = time.Now().Add(-time.Hour)
+	}
+	liveness.mu.Unlock()
+	expireSeries(time.Now().Add(-time.Minute))
+	registryMetrics.mu.Lock()
+	remaining, total := len(usage), seriesTotal
+	registryMetrics.mu.Unlock()
+	if remaining != 0 || total != 0 {
+		t.Errorf("expired printers: got %d budgets and %d series, expected 0", remaining, total)
+	}
+
+	// limits of all printers together
+	if err := SetFilter(config.UDPFilter{}, config.UDPLimits{MaxFamiliesTotal: 3, MaxSeriesTotal: 4}); err != nil {
+		t.Fatal(err)
+	}
+	process(format.LogParts{"hostname": "total", "client": "10.0.0.4:5000",
+		"message": "msg=1,tm=100,v=4 limit_a v=1 100\nlimit_b,n=1 v=1 100\nlimit_b,n=2 v=1 100\nlimit_b,n=3 v=1 100\nlimit_b,n=4 v=1 100"}, "prusa_")
+	process(format.LogParts{"hostname": "total2", "client": "10.0.0.5:5000", "message": "msg=1,tm=100,v=4 limit_d v=1 100"}, "prusa_")
+	for _, c := range []struct {
+		mac      string
+		reason   string
+		expected float64
+	}{
+		{"total", reasonTotalSeriesLimit, 1},
+		{"total2", reasonTotalFamilyLimit, 1},
+	} {
+		if value := testutil.ToFloat64(rejectedSamples.WithLabelValues(c.mac, c.reason)); value != c.expected {
+			t.Errorf("%s of %s = %v, expected %v", c.reason, c.mac, value, c.expected)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package udp
+
+import (
+	"context"
+	"time"
+
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/pstrobl96/prusa_exporter/config"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	influxPointsWritten = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "prusa_udp_influxdb_points_written_total",
+			Help: "Number of points written to InfluxDB.",
+		},
+	)
+	influxPointsDropped = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "prusa_udp_influxdb_points_dropped_total",
+			Help: "Number of points that were not written to InfluxDB.",
+		},
+		[]string{"reason"},
+	)
+
+	influx *influxSink
+)
+
+// influxSink writes parsed udp points to InfluxDB v2 in batches
+type influxSink struct {
+	client        influxdb2.Client
+	writeAPI      api.WriteAPIBlocking
+	queue         chan *write.Point
+	batchSize     int
+	flushInterval time.Duration
+	maxRetries    int
+}
+
+// StartInfluxDB starts writing of all udp points to InfluxDB. Init must be called first.
+func StartInfluxDB(cfg config.InfluxDB) {
+	udpRegistry.MustRegister(influxPointsWritten, influxPointsDropped)
+	influx = newInfluxSink(cfg)
+	go influx.run()
+}
+
+func newInfluxSink(cfg config.InfluxDB) *influxSink {
+	batchSize := cfg.BatchSize
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+	flushInterval := time.Duration(cfg.FlushInterval) * time.Second
+	if flushInterval <= 0 {
+		flushInterval = 10 * time.Second
+	}
+	maxRetries := cfg.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = 3
+	}
+	queueSize := cfg.QueueSize
+	if queueSize <= 0 {
+		queueSize = 10 * batchSize
+	}
+
+	client := influxdb2.NewClient(cfg.URL, cfg.Token)
+
+	return &influxSink{
+		client:        client,
+		writeAPI:      client.WriteAPIBlocking(cfg.Org, cfg.Bucket),
+		queue:         make(chan *write.Point, queueSize),
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		maxRetries:    maxRetries,
+	}
+}
+
+// write queues the point, it is dropped when the queue is full
+func (s *influxSink) write(p point) {
+	select {
+	case s.queue <- influxdb2.NewPoint(p.Measurement, p.Tags, p.Fields, p.Time):
+	default:
+		influxPointsDropped.WithLabelValues("queue_full").Inc()
+	}
+}
+
+func (s *influxSink) run() {
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*write.Point, 0, s.batchSize)
+	for {
+		select {
+		case p := <-s.queue:
+			batch = append(batch, p)
+			if len(batch) < s.batchSize {
+				continue
+			}
+		case <-ticker.C:
+		}
+
+		s.flush(batch)
+		batch = batch[:0]
+	}
+}
+
+// flush writes the batch, retrying with exponential backoff
+func (s *influxSink) flush(batch []*write.Point) {
+	if len(batch) == 0 {
+		return
+	}
+
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), s.flushInterval)
+		err := s.writeAPI.WritePoint(ctx, batch...)
+		cancel()
+
+		if err == nil {
+			influxPointsWritten.Add(float64(len(batch)))
+			return
+		}
+
+		if attempt >= s.maxRetries {
+			log.Error().Msgf("Error writing %d points to InfluxDB, dropping them: %v", len(batch), err)
+			influxPointsDropped.WithLabelValues("write_failed").Add(float64(len(batch)))
+			return
+		}
+
+		log.Warn().Msgf("Error writing %d points to InfluxDB, retrying in %s: %v", len(batch), backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
@@ -0,0 +1,57 @@
+package udp
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pstrobl96/prusa_exporter/config"
+)
+
+func TestInfluxSinkWritesBatch(t *testing.T) {
+	requests := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/write" || r.URL.Query().Get("bucket") != "printers" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		body, _ := io.ReadAll(r.Body)
+		requests <- string(body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sink := newInfluxSink(config.InfluxDB{URL: server.URL, Org: "farm", Bucket: "printers", Token: "token", BatchSize: 2})
+	go sink.run()
+
+	sampled := time.Unix(1700000000, 0)
+	sink.write(point{
+		Measurement: "prusa_temp_noz",
+		Tags:        map[string]string{"mac": "aa", "ip": "10.0.0.1"},
+		Fields:      map[string]interface{}{"v": 215.5},
+		Time:        sampled,
+	})
+	sink.write(point{
+		Measurement: "prusa_fan",
+		Tags:        map[string]string{"mac": "aa", "ip": "10.0.0.1", "fan": "1"},
+		Fields:      map[string]interface{}{"rpm": int64(100)},
+		Time:        sampled,
+	})
+
+	select {
+	case body := <-requests:
+		want := []string{
+			"prusa_temp_noz,ip=10.0.0.1,mac=aa v=215.5 1700000000000000000",
+			"prusa_fan,fan=1,ip=10.0.0.1,mac=aa rpm=100i 1700000000000000000",
+		}
+		for _, line := range want {
+			if !strings.Contains(body, line) {
+				t.Errorf("write body %q does not contain %q", body, line)
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no write request received")
+	}
+}
@@ -0,0 +1,112 @@
+package udp
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"github.com/pstrobl96/prusa_exporter/config"
+	"github.com/rs/zerolog/log"
+)
+
+// maxDatagramSize is the largest line protocol datagram that is read
+const maxDatagramSize = 65535
+
+// lineSender is a sender of line protocol identified by the identity tag or the source address
+type lineSender struct {
+	mac        string
+	printer    config.Printers
+	configured bool
+	lines      []string
+	points     []*point
+}
+
+// listenLines receives datagrams of plain line protocol until the connection is closed
+func listenLines(conn net.PacketConn, listener config.Listener, prefix string) {
+	name := listenerName(listener)
+	buffer := make([]byte, maxDatagramSize)
+	for {
+		n, addr, err := conn.ReadFrom(buffer)
+		if err != nil {
+			log.Error().Msg("Error reading from line protocol listener " + name + ": " + err.Error())
+			return
+		}
+		listenerMessages.WithLabelValues(name).Inc()
+		listenerBytes.WithLabelValues(name).Add(float64(n))
+
+		processLines(string(buffer[:n]), addr.String(), listener.IdentityTag, prefix)
+	}
+}
+
+// processLines processes a datagram of line protocol. Lines are sent by the printer which mac or name is
+// in the tag identityTag, or by the source address otherwise - the tag is kept then, so unknown identities
+// are limited as series of the address. Timestamps of lines are ignored, samples get the time they were received.
+func processLines(payload string, client string, identityTag string, prefix string) {
+	received := time.Now()
+	host, _, err := net.SplitHostPort(client)
+	if err != nil {
+		host = client
+	}
+	if reason := checkAddress(host); reason != "" {
+		rejectMessage(host, host, reason)
+		return
+	}
+
+	senders := make(map[string]*lineSender)
+	var order []*lineSender
+	for _, line := range strings.Split(payload, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		point, err := parseLineProtocol(line)
+		if err != nil {
+			log.Debug().Msgf("Error parsing line '%s': %v", line, err)
+			parseFailures.WithLabelValues(host, failureReason(line, err)).Inc()
+			continue
+		}
+
+		mac, printer, configured := host, config.Printers{}, false
+		if identity, ok := point.Tags[identityTag]; ok && identityTag != "" {
+			if printer, configured = lookupIdentity(identity); configured {
+				mac = identity
+				delete(point.Tags, identityTag)
+			}
+		}
+		sender, ok := senders[mac]
+		if !ok {
+			sender = &lineSender{mac: mac, printer: printer, configured: configured}
+			senders[mac] = sender
+			order = append(order, sender)
+		}
+		sender.lines = append(sender.lines, line)
+		sender.points = append(sender.points, point)
+	}
+
+	for _, sender := range order {
+		if reason := checkSource(sender.mac, host); reason != "" {
+			rejectMessage(sender.mac, host, reason)
+			continue
+		}
+		observeMessage(sender.mac, strings.Join(sender.lines, "\n"))
+		if !sender.configured {
+			sender.printer, sender.configured = lookupPrinter(sender.mac, host)
+		}
+		markSeen(sender.mac, host)
+
+		points := make([]*point, 0, len(sender.points))
+		for i, point := range sender.points {
+			point.Source = point.Measurement
+			point.Measurement = prefix + point.Measurement
+			point.Tags["mac"] = sender.mac
+			point.Tags["ip"] = host
+			point.Ticks = -1
+			if acceptPoint(point, sender.lines[i], sender.mac, sender.printer, sender.configured) {
+				points = append(points, point)
+			}
+		}
+
+		exportPoints(points, sender.mac, -1, received)
+	}
+}
@@ -0,0 +1,94 @@
+package udp
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/pstrobl96/prusa_exporter/config"
+)
+
+func TestProcessLines(t *testing.T) {
+	Init(prometheus.NewRegistry(), false)
+	SetPrinters(config.Config{Printers: []config.Printers{{Address: "10.0.0.50", Name: "voron", Type: "Voron"}}})
+	t.Cleanup(func() {
+		lastPush.Reset()
+		SetPrinters(config.Config{})
+	})
+
+	// identity of a configured printer is its mac, other identities stay a tag of the source address
+	payload := "# comment\n" +
+		"klipper_temp,host=other,sensor=bed v=40\n" +
+		"klipper_temp,host=voron,sensor=bed v=60.5 1700000000000000000\n" +
+		"klipper_temp,broken v=1\n"
+	processLines(payload, "10.0.0.7:5000", "host", "prusa_")
+
+	expected := `
+# HELP prusa_klipper_temp Metric for prusa_klipper_temp from prusa_klipper_temp
+# TYPE prusa_klipper_temp gauge
+prusa_klipper_temp{host="",ip="10.0.0.7",mac="voron",printer_model="Voron",printer_name="voron",sensor="bed"} 60.5
+prusa_klipper_temp{host="other",ip="10.0.0.7",mac="10.0.0.7",printer_model="",printer_name="",sensor="bed"} 40
+`
+	if err := testutil.CollectAndCompare(registryMetrics.metrics["prusa_klipper_temp"], strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+	if value := testutil.ToFloat64(parseFailures.WithLabelValues("10.0.0.7", reasonBadTag)); value != 1 {
+		t.Errorf("bad tag = %v, expected 1", value)
+	}
+	if value := testutil.ToFloat64(messagesReceived.WithLabelValues("voron")); value != 1 {
+		t.Errorf("messages of voron = %v, expected 1", value)
+	}
+}
+
+func TestProcessLinesRejectedSource(t *testing.T) {
+	Init(prometheus.NewRegistry(), false)
+	var cfg config.Config
+	cfg.UDP.Sources = config.UDPSources{AllowedCIDRs: []string{"10.0.0.0/24"}}
+	SetSources(cfg)
+	t.Cleanup(func() { SetSources(config.Config{}) })
+
+	rejected := testutil.ToFloat64(rejectedMessages.WithLabelValues(reasonSourceNotAllowed))
+	processLines("rejected_line,broken v=1\nrejected_line v=1\n", "192.168.1.7:5000", "", "prusa_")
+
+	if value := testutil.ToFloat64(rejectedMessages.WithLabelValues(reasonSourceNotAllowed)); value != rejected+1 {
+		t.Errorf("rejected = %v, expected %v", value, rejected+1)
+	}
+	if value := testutil.ToFloat64(parseFailures.WithLabelValues("192.168.1.7", reasonBadTag)); value != 0 {
+		t.Errorf("bad tag of rejected source = %v, expected 0", value)
+	}
+}
+
+func TestLineListener(t *testing.T) {
+	Init(prometheus.NewRegistry(), false)
+	t.Cleanup(func() { lastPush.Reset() })
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener := config.Listener{Address: conn.LocalAddr().String(), Format: "line"}
+	go listenLines(conn, listener, "prusa_")
+	defer conn.Close()
+
+	client, err := net.Dial("udp", listener.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	client.Write([]byte("line_listener v=1\n"))
+
+	mac := client.LocalAddr().(*net.UDPAddr).IP.String()
+	deadline := time.Now().Add(5 * time.Second)
+	for testutil.ToFloat64(linesParsed.WithLabelValues(mac)) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("line was not processed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if value := testutil.ToFloat64(listenerMessages.WithLabelValues(listenerName(listener))); value != 1 {
+		t.Errorf("messages = %v, expected 1", value)
+	}
+}
@@ -0,0 +1,125 @@
+package udp
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Reasons of parse failures in prusa_udp_parse_failures_total
+const (
+	reasonMissingIdentifiers = "missing_identifiers"
+	reasonInvalidFormat      = "invalid_format"
+	reasonBadTag             = "bad_tag"
+	reasonBadField           = "bad_field"
+	reasonFirmwareError      = "firmware_error"
+)
+
+// firmwareErrors are strings the printer sends instead of a value when reading of the metric failed
+var firmwareErrors = []string{"value_too_long"}
+
+// Metrics of the UDP pipeline itself, labelled by mac of the printer
+var (
+	messagesReceived = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "prusa_udp_messages_received_total",
+			Help: "Number of syslog messages received from the printer.",
+		},
+		[]string{"mac"},
+	)
+	bytesReceived = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "prusa_udp_received_bytes_total",
+			Help: "Number of bytes of syslog messages received from the printer.",
+		},
+		[]string{"mac"},
+	)
+	linesParsed = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "prusa_udp_lines_parsed_total",
+			Help: "Number of metric lines parsed from syslog messages of the printer.",
+		},
+		[]string{"mac"},
+	)
+	parseFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "prusa_udp_parse_failures_total",
+			Help: "Number of syslog messages or lines of the printer that could not be parsed, by reason.",
+		},
+		[]string{"mac", "reason"},
+	)
+	unknownValues = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "prusa_udp_unknown_values_total",
+			Help: "Number of field values of unsupported type exported as 0, by Go type of the value.",
+		},
+		[]string{"mac", "type"},
+	)
+	familiesCreated = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "prusa_udp_metric_families_created_total",
+			Help: "Number of metric families created for metrics first sent by the printer.",
+		},
+		[]string{"mac"},
+	)
+	rejectedSamples = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "prusa_udp_rejected_samples_total",
+			Help: "Number of samples of the printer that were not exported because of filter or limits, by reason.",
+		},
+		[]string{"mac", "reason"},
+	)
+	channelBacklog = prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "prusa_udp_channel_backlog",
+			Help: "Number of received syslog messages waiting to be processed.",
+		},
+		func() float64 {
+			listenerChannels.mu.Lock()
+			defer listenerChannels.mu.Unlock()
+			backlog := 0
+			for _, channel := range listenerChannels.channels {
+				backlog += len(channel)
+			}
+			return float64(backlog)
+		},
+	)
+
+	pipelineMetrics = []prometheus.Collector{
+		messagesReceived, bytesReceived, linesParsed, parseFailures, unknownValues, familiesCreated, rejectedSamples, rejectedMessages, channelBacklog,
+		listenerUp, listenerMessages, listenerBytes,
+	}
+)
+
+// parseError is returned by parseLineProtocol, reason is used as label of prusa_udp_parse_failures_total
+type parseError struct {
+	reason string
+	err    error
+}
+
+func (e *parseError) Error() string {
+	return e.err.Error()
+}
+
+// observeMessage counts the received message of the printer
+func observeMessage(mac string, message string) {
+	messagesReceived.WithLabelValues(mac).Inc()
+	bytesReceived.WithLabelValues(mac).Add(float64(len(message)))
+}
+
+// failureReason returns why the line could not be parsed. Lines with errors reported by firmware
+// are counted apart from malformed ones.
+func failureReason(line string, err error) string {
+	for _, firmwareError := range firmwareErrors {
+		if strings.Contains(line, firmwareError) {
+			return reasonFirmwareError
+		}
+	}
+
+	var parseErr *parseError
+	if errors.As(err, &parseErr) {
+		return parseErr.reason
+	}
+	return reasonInvalidFormat
+}
@@ -0,0 +1,109 @@
+package udp
+
+import (
+	"sync"
+
+	"github.com/pstrobl96/prusa_exporter/config"
+	"github.com/rs/zerolog/log"
+)
+
+// printerLabels are added to every udp series so they can be joined with PrusaLink metrics.
+// They are empty when the printer is not configured.
+var printerLabels = []string{"printer_name", "printer_model"}
+
+var printers = printerDirectory{
+	byMac:     make(map[string]config.Printers),
+	byIP:      make(map[string]config.Printers),
+	byAddress: make(map[string]config.Printers),
+	byName:    make(map[string]config.Printers),
+	learned:   make(map[string]string),
+}
+
+// printerDirectory finds configured printers of udp metrics by mac, or by address they push from
+type printerDirectory struct {
+	mu        sync.RWMutex
+	byMac     map[string]config.Printers
+	byIP      map[string]config.Printers
+	byAddress map[string]config.Printers
+	byName    map[string]config.Printers // printers are found by name only by identity of line protocol
+	learned   map[string]string          // mac to the configured address of the printer it was matched with
+}
+
+// SetPrinters sets printers that udp metrics are matched with
+func SetPrinters(cfg config.Config) {
+	byMac := make(map[string]config.Printers)
+	byIP := make(map[string]config.Printers)
+	byAddress := make(map[string]config.Printers)
+	byName := make(map[string]config.Printers)
+	for _, printer := range cfg.Printers {
+		byAddress[printer.Address] = printer
+		if printer.Name != "" {
+			byName[printer.Name] = printer
+		}
+		if printer.Mac != "" {
+			byMac[config.NormalizeMac(printer.Mac)] = printer
+		}
+		for _, ip := range printerIPs(printer.Address) {
+			byIP[ip] = printer
+		}
+	}
+
+	printers.mu.Lock()
+	printers.byMac = byMac
+	printers.byIP = byIP
+	printers.byAddress = byAddress
+	printers.byName = byName
+	printers.mu.Unlock()
+}
+
+// lookupIdentity returns configured printer with the mac or name sent as identity of line protocol
+func lookupIdentity(identity string) (config.Printers, bool) {
+	printers.mu.RLock()
+	defer printers.mu.RUnlock()
+	if printer, ok := printers.byMac[config.NormalizeMac(identity)]; ok {
+		return printer, true
+	}
+	printer, ok := printers.byName[identity]
+	return printer, ok
+}
+
+// lookupPrinter returns configured printer with the mac. Printers without mac are matched by the address
+// the metrics are pushed from and the mac is remembered, so the printer is found even when it gets another address.
+func lookupPrinter(mac string, ip string) (config.Printers, bool) {
+	mac = config.NormalizeMac(mac)
+
+	printers.mu.RLock()
+	printer, ok := printers.byMac[mac]
+	if !ok {
+		if address, learned := printers.learned[mac]; learned {
+			printer, ok = printers.byAddress[address]
+			ok = ok && printer.Mac == ""
+		}
+	}
+	printers.mu.RUnlock()
+	if ok {
+		return printer, true
+	}
+
+	printers.mu.Lock()
+	defer printers.mu.Unlock()
+	printer, ok = printers.byIP[ip]
+	if !ok || printer.Mac != "" { // printer with mac was not matched by it
+		return config.Printers{}, false
+	}
+	if printers.learned[mac] != printer.Address {
+		printers.learned[mac] = printer.Address
+		log.Info().Msgf("Udp metrics of %s matched with printer %s at %s", mac, printer.Name, printer.Address)
+	}
+	return printer, true
+}
+
+// labelPrinter sets labels of the configured printer to the point
+func labelPrinter(p *point, printer config.Printers) {
+	if printer.Name != "" {
+		p.Tags["printer_name"] = printer.Name
+	}
+	if printer.Type != "" {
+		p.Tags["printer_model"] = printer.Type
+	}
+}
@@ -0,0 +1,64 @@
+package udp
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/pstrobl96/prusa_exporter/config"
+	"gopkg.in/mcuadros/go-syslog.v2/format"
+)
+
+func TestLookupPrinter(t *testing.T) {
+	var cfg config.Config
+	cfg.Printers = []config.Printers{
+		{Address: "10.0.0.1", Name: "mk4", Type: "MK4", Mac: "10:9C:70:00:00:01"},
+		{Address: "10.0.0.2:80", Name: "xl", Type: "XL"},
+	}
+	SetPrinters(cfg)
+	t.Cleanup(func() { SetPrinters(config.Config{}) })
+
+	type testCase struct {
+		Mac  string
+		IP   string
+		Name string
+	}
+	cases := []testCase{
+		{"109c70000001", "10.0.0.9", "mk4"}, // matched by mac from any address
+		{"109c70000002", "10.0.0.1", ""},    // address of printer with another mac
+		{"109c70000003", "10.0.0.2", "xl"},  // matched by address
+		{"109c70000003", "10.0.0.3", "xl"},  // mac was learned
+		{"109c70000004", "10.0.0.4", ""},
+	}
+	for _, tc := range cases {
+		printer, _ := lookupPrinter(tc.Mac, tc.IP)
+		if printer.Name != tc.Name {
+			t.Errorf("lookupPrinter(%s, %s): got %q, want %q", tc.Mac, tc.IP, printer.Name, tc.Name)
+		}
+	}
+}
+
+func TestProcessPrinterLabels(t *testing.T) {
+	Init(prometheus.NewRegistry(), false)
+	var cfg config.Config
+	cfg.Printers = []config.Printers{{Address: "10.0.0.5", Name: "core", Type: "COREONE"}}
+	SetPrinters(cfg)
+	t.Cleanup(func() {
+		SetPrinters(config.Config{})
+		lastPush.Reset()
+	})
+
+	process(format.LogParts{"hostname": "labels", "client": "10.0.0.5:5000", "message": "msg=1,tm=100,v=4 labelled v=1 100"}, "prusa_")
+	process(format.LogParts{"hostname": "unknown", "client": "10.0.0.6:5000", "message": "msg=1,tm=100,v=4 labelled v=2 100"}, "prusa_")
+
+	expected := `
+# HELP prusa_labelled Metric for prusa_labelled from prusa_labelled
+# TYPE prusa_labelled gauge
+prusa_labelled{ip="10.0.0.5",mac="labels",printer_model="COREONE",printer_name="core"} 1
+prusa_labelled{ip="10.0.0.6",mac="unknown",printer_model="",printer_name=""} 2
+`
+	if err := testutil.CollectAndCompare(registryMetrics.metrics["prusa_labelled"], strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
@@ -1,9 +1,15 @@
 package udp
 
 import (
+	"fmt"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/pstrobl96/prusa_exporter/config"
 	"github.com/rs/zerolog/log"
 )
 
@@ -15,72 +21,266 @@ var (
 		},
 		[]string{"mac", "ip"},
 	)
+	expiredSeries = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "prusa_udp_expired_series_total",
+			Help: "Number of series removed because the printer stopped pushing metrics.",
+		},
+	)
 	udpRegistry *prometheus.Registry
 
+	liveness = printerLiveness{
+		seen: make(map[printerID]time.Time),
+	}
+
 	registryMetrics = safeRegistryMetrics{
 		mu:      sync.Mutex{},
-		metrics: make(map[string]*prometheus.GaugeVec),
+		metrics: make(map[string]*sampleVec),
 	}
+
+	deviceTimestamps bool
 )
 
 type safeRegistryMetrics struct {
 	mu      sync.Mutex
-	metrics map[string]*prometheus.GaugeVec
+	metrics map[string]*sampleVec
 	labels  map[string][]string
 }
 
+// sampleVec is a GaugeVec that remembers when each of its series was sampled by the printer
+// and exposes the series with that timestamp when device timestamps are enabled.
+type sampleVec struct {
+	*prometheus.GaugeVec
+
+	mu    sync.Mutex
+	times map[string]time.Time
+}
+
+func newSampleVec(gauge *prometheus.GaugeVec) *sampleVec {
+	return &sampleVec{
+		GaugeVec: gauge,
+		times:    make(map[string]time.Time),
+	}
+}
+
+// set sets the value of the series sampled at the given time
+func (v *sampleVec) set(labelNames []string, labelValues []string, value float64, sampled time.Time) {
+	pairs := make([]*dto.LabelPair, len(labelNames))
+	for i := range labelNames {
+		pairs[i] = &dto.LabelPair{Name: &labelNames[i], Value: &labelValues[i]}
+	}
+
+	v.mu.Lock()
+	v.GaugeVec.WithLabelValues(labelValues...).Set(value)
+	v.times[seriesKey(pairs)] = sampled
+	v.mu.Unlock()
+}
+
+// Collect implements prometheus.Collector
+func (v *sampleVec) Collect(ch chan<- prometheus.Metric) {
+	if !deviceTimestamps {
+		v.GaugeVec.Collect(ch)
+		return
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		v.GaugeVec.Collect(metrics)
+		close(metrics)
+	}()
+
+	times := make(map[string]time.Time, len(v.times))
+	for metric := range metrics {
+		var m dto.Metric
+		if err := metric.Write(&m); err != nil {
+			ch <- metric
+			continue
+		}
+
+		key := seriesKey(m.GetLabel())
+		sampled, ok := v.times[key]
+		if !ok {
+			ch <- metric
+			continue
+		}
+		times[key] = sampled // series removed from the vector are forgotten here
+		ch <- prometheus.NewMetricWithTimestamp(sampled, metric)
+	}
+	v.times = times
+}
+
+// seriesKey returns an unique key of series with the given labels
+func seriesKey(pairs []*dto.LabelPair) string {
+	parts := make([]string, len(pairs))
+	for i, pair := range pairs {
+		parts[i] = pair.GetName() + "=" + pair.GetValue()
+	}
+	slices.Sort(parts)
+	return strings.Join(parts, "\xff")
+}
+
+// printerID identifies a printer by the mac and ip labels of its series
+type printerID struct {
+	mac string
+	ip  string
+}
+
+type printerLiveness struct {
+	mu   sync.Mutex
+	seen map[printerID]time.Time
+}
+
+// markSeen sets the last push timestamp of the printer
+func markSeen(mac string, ip string) {
+	now := time.Now()
+	lastPush.WithLabelValues(mac, ip).Set(float64(now.Unix()))
+
+	liveness.mu.Lock()
+	liveness.seen[printerID{mac, ip}] = now
+	liveness.mu.Unlock()
+}
+
+// ExpireSeries periodically removes series of printers that did not push metrics for longer than ttl.
+// The last push timestamp is kept so it is still visible when the printer was seen for the last time.
+func ExpireSeries(ttl time.Duration) {
+	ticker := time.NewTicker(max(ttl/2, time.Second))
+	defer ticker.Stop()
+
+	for range ticker.C {
+		expireSeries(time.Now().Add(-ttl))
+	}
+}
+
+// expireSeries removes series of printers last seen before deadline and returns number of removed series
+func expireSeries(deadline time.Time) int {
+	var stale []printerID
+
+	live := make(map[string]bool)
+	liveness.mu.Lock()
+	for id, seen := range liveness.seen {
+		if seen.Before(deadline) {
+			stale = append(stale, id)
+			delete(liveness.seen, id)
+			continue
+		}
+		live[id.ip] = true
+		live[config.NormalizeMac(id.mac)] = true
+	}
+	liveness.mu.Unlock()
+
+	if len(stale) == 0 {
+		return 0
+	}
+
+	removed := 0
+	registryMetrics.mu.Lock()
+	for name, metric := range registryMetrics.metrics {
+		if name == "last_push" {
+			continue
+		}
+		for _, id := range stale {
+			removed += metric.DeletePartialMatch(prometheus.Labels{"mac": id.mac, "ip": id.ip})
+		}
+	}
+	// budget is forgotten when no printer that is still pushing is counted to it
+	for _, id := range stale {
+		for _, budget := range []string{id.ip, config.NormalizeMac(id.mac)} {
+			if !live[budget] {
+				forgetUsage(budget)
+			}
+		}
+	}
+	registryMetrics.mu.Unlock()
+
+	for _, id := range stale {
+		log.Info().Msgf("Printer %s (%s) stopped pushing metrics, its series expired", id.mac, id.ip)
+	}
+	expiredSeries.Add(float64(removed))
+
+	return removed
+}
+
 // Init initializes the Prometheus udp registry.
-func Init(udpMainRegistry *prometheus.Registry) {
+// With useDeviceTimestamps samples are exposed with the time they were taken by the printer instead of scrape time.
+func Init(udpMainRegistry *prometheus.Registry, useDeviceTimestamps bool) {
 	udpRegistry = udpMainRegistry
+	deviceTimestamps = useDeviceTimestamps
 
-	udpRegistry.MustRegister(lastPush)
+	udpRegistry.MustRegister(lastPush, expiredSeries)
+	udpRegistry.MustRegister(pipelineMetrics...)
 	registryMetrics.mu.Lock()
-	registryMetrics.metrics = make(map[string]*prometheus.GaugeVec)
+	registryMetrics.metrics = make(map[string]*sampleVec)
 	registryMetrics.labels = make(map[string][]string)
-	registryMetrics.metrics["last_push"] = lastPush
+	registryMetrics.metrics["last_push"] = newSampleVec(lastPush)
+	usage = make(map[string]*printerUsage)
+	seriesTotal = 0
 	registryMetrics.mu.Unlock()
 }
 
 func registerMetric(point point) {
-	var metric *prometheus.GaugeVec
+	var metric *sampleVec
 
+	budget := budgetKey(point.Tags["mac"], point.Tags["ip"])
 	for key, value := range point.Fields {
-		metricName := point.Measurement
-		tagLabels := getLabels(point.Tags)
-
-		if key != "v" && key != "value" {
-			metricName = metricName + "_" + key
+		floatValue, known := toFloat64(value)
+		if !known {
+			unknownValues.WithLabelValues(point.Tags["mac"], fmt.Sprintf("%T", value)).Inc()
 		}
+		exported := describeField(point, key, floatValue)
+		metricName := exported.name
 
 		registryMetrics.mu.Lock()
+		labelNames, exists := registryMetrics.labels[metricName]
+		if !exists {
+			labelNames = getLabels(exported.labels)
+		}
+		labels := []string{}
+
+		for _, label := range labelNames {
+			labels = append(labels, exported.labels[label])
+
+		}
+
+		if !admit(point.Tags["mac"], budget, metricName, labels) {
+			registryMetrics.mu.Unlock()
+			continue
+		}
+
 		if existingMetric, exists := registryMetrics.metrics[metricName]; exists {
 			metric = existingMetric
 		} else {
 			// Create a new metric with the given point
-			metric = prometheus.NewGaugeVec(
+			metric = newSampleVec(prometheus.NewGaugeVec(
 				prometheus.GaugeOpts{
 					Name: metricName,
-					Help: "Metric for " + metricName + " from " + point.Measurement,
+					Help: exported.help,
 				},
-				tagLabels,
-			)
+				labelNames,
+			))
 			if err := udpRegistry.Register(metric); err != nil {
 				log.Trace().Msgf("Metric already registered %s: %v", metricName, err) // not a neccessary and error
 			}
+			familiesCreated.WithLabelValues(point.Tags["mac"]).Inc()
 			registryMetrics.metrics[metricName] = metric
-			registryMetrics.labels[metricName] = tagLabels
+			registryMetrics.labels[metricName] = labelNames
 		}
 
-		labels := []string{}
-
-		for _, label := range registryMetrics.labels[metricName] {
-			labels = append(labels, point.Tags[label])
+		registryMetrics.mu.Unlock()
+		metric.set(labelNames, labels, exported.value, point.Time)
 
+		if remoteWrite != nil {
+			sampleLabels := make(map[string]string, len(labelNames))
+			for i, name := range labelNames {
+				if labels[i] != "" {
+					sampleLabels[name] = labels[i]
+				}
+			}
+			remoteWrite.write(sample{name: metricName, labels: sampleLabels, value: exported.value, time: point.Time})
 		}
 
-		registryMetrics.mu.Unlock()
-		metric.WithLabelValues(labels...).Set(toFloat64(value))
-
 	}
 }
 
@@ -92,50 +292,51 @@ func getLabels(tags map[string]string) []string {
 	return labels
 }
 
-func toFloat64(value interface{}) float64 {
+// toFloat64 converts the field value to float64, false is returned for values of unsupported type
+func toFloat64(value interface{}) (float64, bool) {
 	switch v := value.(type) {
 	case int:
-		return float64(v)
+		return float64(v), true
 	case int64:
-		return float64(v)
+		return float64(v), true
 	case float64:
-		return v
+		return v, true
 	case bool:
 		if v {
-			return 1.0
+			return 1.0, true
 		}
-		return 0.0
+		return 0.0, true
 	case nil:
 		log.Warn().Msg("Received nil value, returning 0.0")
-		return 0.0
+		return 0.0, false
 	case string:
 		if v == "PLA" {
-			return 1.0
+			return 1.0, true
 		} else if v == "PETG" {
-			return 2.0
+			return 2.0, true
 		} else if v == "ASA" {
-			return 3.0
+			return 3.0, true
 		} else if v == "PC" {
-			return 4.0
+			return 4.0, true
 		} else if v == "PVB" {
-			return 5.0
+			return 5.0, true
 		} else if v == "ABS" {
-			return 6.0
+			return 6.0, true
 		} else if v == "HIPS" {
-			return 7.0
+			return 7.0, true
 		} else if v == "PP" {
-			return 8.0
+			return 8.0, true
 		} else if v == "FLEX" {
-			return 9.0
+			return 9.0, true
 		} else if v == "PA" {
-			return 10.0
+			return 10.0, true
 		} else if v == "---" {
-			return -1.0 // special case for "---" to indicate no loaded filament
+			return -1.0, true // special case for "---" to indicate no loaded filament
 		} else {
-			return 0.0 // return for custom
+			return 0.0, true // return for custom
 		}
 	default:
 		log.Warn().Msgf("Unsupported type %T for value %v", value, value)
-		return 0.0
+		return 0.0, false
 	}
 }
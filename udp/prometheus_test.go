@@ -0,0 +1,42 @@
+package udp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestExpireSeries(t *testing.T) {
+	Init(prometheus.NewRegistry(), true)
+
+	registerMetric(point{
+		Measurement: "prusa_temp_noz",
+		Tags:        map[string]string{"mac": "aa", "ip": "10.0.0.1"},
+		Fields:      map[string]interface{}{"v": 215.0},
+	})
+	registerMetric(point{
+		Measurement: "prusa_temp_noz",
+		Tags:        map[string]string{"mac": "bb", "ip": "10.0.0.2"},
+		Fields:      map[string]interface{}{"v": 20.0},
+	})
+	markSeen("aa", "10.0.0.1")
+	markSeen("bb", "10.0.0.2")
+
+	liveness.mu.Lock()
+	liveness.seen[printerID{"aa", "10.0.0.1"}] = time.Now().Add(-time.Hour)
+	liveness.mu.Unlock()
+
+	if removed := expireSeries(time.Now().Add(-time.Minute)); removed != 1 {
+		t.Errorf("expireSeries: removed %d series, want 1", removed)
+	}
+
+	if count := testutil.CollectAndCount(registryMetrics.metrics["prusa_temp_noz"]); count != 1 {
+		t.Errorf("prusa_temp_noz: got %d series, want 1", count)
+	}
+
+	if count := testutil.CollectAndCount(lastPush); count != 2 {
+		t.Errorf("last push: got %d series, want 2", count)
+	}
+}
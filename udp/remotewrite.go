@@ -0,0 +1,240 @@
+package udp
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/pstrobl96/prusa_exporter/config"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+var (
+	remoteWriteSamplesSent = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "prusa_udp_remote_write_samples_sent_total",
+			Help: "Number of samples sent to the remote_write endpoint.",
+		},
+	)
+	remoteWriteSamplesDropped = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "prusa_udp_remote_write_samples_dropped_total",
+			Help: "Number of samples that were not sent to the remote_write endpoint.",
+		},
+		[]string{"reason"},
+	)
+	remoteWriteRetries = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "prusa_udp_remote_write_retries_total",
+			Help: "Number of retried remote_write requests.",
+		},
+	)
+
+	remoteWrite *remoteWriteSink
+)
+
+// sample is a single value of a udp metric as produced by registerMetric
+type sample struct {
+	name   string
+	labels map[string]string
+	value  float64
+	time   time.Time
+}
+
+// remoteWriteSink pushes udp samples to a Prometheus remote_write endpoint
+type remoteWriteSink struct {
+	cfg           config.RemoteWrite
+	client        *http.Client
+	queue         chan sample
+	batchSize     int
+	flushInterval time.Duration
+	maxRetries    int
+}
+
+// recoverableError is returned for failed requests that are worth retrying
+type recoverableError struct {
+	error
+}
+
+// StartRemoteWrite starts pushing of all udp samples to the remote_write endpoint. Init must be called first.
+func StartRemoteWrite(cfg config.RemoteWrite) {
+	remoteWrite = newRemoteWriteSink(cfg)
+	udpRegistry.MustRegister(remoteWriteSamplesSent, remoteWriteSamplesDropped, remoteWriteRetries,
+		prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{
+				Name: "prusa_udp_remote_write_queue_length",
+				Help: "Number of samples waiting to be sent to the remote_write endpoint.",
+			},
+			func() float64 { return float64(len(remoteWrite.queue)) },
+		))
+	go remoteWrite.run()
+}
+
+func newRemoteWriteSink(cfg config.RemoteWrite) *remoteWriteSink {
+	batchSize := cfg.BatchSize
+	if batchSize <= 0 {
+		batchSize = 2000
+	}
+	flushInterval := time.Duration(cfg.FlushInterval) * time.Second
+	if flushInterval <= 0 {
+		flushInterval = 5 * time.Second
+	}
+	maxRetries := cfg.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = 5
+	}
+	queueSize := cfg.QueueSize
+	if queueSize <= 0 {
+		queueSize = 10 * batchSize
+	}
+
+	return &remoteWriteSink{
+		cfg:           cfg,
+		client:        &http.Client{Timeout: 30 * time.Second},
+		queue:         make(chan sample, queueSize),
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		maxRetries:    maxRetries,
+	}
+}
+
+// write queues the sample, it is dropped when the queue is full
+func (s *remoteWriteSink) write(smp sample) {
+	select {
+	case s.queue <- smp:
+	default:
+		remoteWriteSamplesDropped.WithLabelValues("queue_full").Inc()
+	}
+}
+
+func (s *remoteWriteSink) run() {
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]sample, 0, s.batchSize)
+	for {
+		select {
+		case smp := <-s.queue:
+			batch = append(batch, smp)
+			if len(batch) < s.batchSize {
+				continue
+			}
+		case <-ticker.C:
+		}
+
+		s.flush(batch)
+		batch = batch[:0]
+	}
+}
+
+// flush sends the batch, retrying recoverable errors with exponential backoff
+func (s *remoteWriteSink) flush(batch []sample) {
+	if len(batch) == 0 {
+		return
+	}
+
+	body := snappy.Encode(nil, encodeWriteRequest(batch))
+
+	backoff := 500 * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		err := s.send(body)
+		if err == nil {
+			remoteWriteSamplesSent.Add(float64(len(batch)))
+			return
+		}
+
+		if _, ok := err.(recoverableError); !ok || attempt >= s.maxRetries {
+			log.Error().Msgf("Error sending %d samples to remote_write endpoint, dropping them: %v", len(batch), err)
+			remoteWriteSamplesDropped.WithLabelValues("send_failed").Add(float64(len(batch)))
+			return
+		}
+
+		log.Warn().Msgf("Error sending %d samples to remote_write endpoint, retrying in %s: %v", len(batch), backoff, err)
+		remoteWriteRetries.Inc()
+		time.Sleep(backoff)
+		backoff = min(2*backoff, 30*time.Second)
+	}
+}
+
+func (s *remoteWriteSink) send(body []byte) error {
+	req, err := http.NewRequest("POST", s.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "prusa_exporter")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	if s.cfg.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+s.cfg.BearerToken)
+	} else if s.cfg.Username != "" {
+		req.SetBasicAuth(s.cfg.Username, s.cfg.Password)
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return recoverableError{err}
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 == 2 {
+		return nil
+	}
+
+	message, _ := io.ReadAll(io.LimitReader(res.Body, 256))
+	err = fmt.Errorf("server returned HTTP status %s: %s", res.Status, bytes.TrimSpace(message))
+	if res.StatusCode/100 == 5 || res.StatusCode == http.StatusTooManyRequests {
+		return recoverableError{err}
+	}
+	return err
+}
+
+// encodeWriteRequest encodes samples as a remote_write v1 prometheus.WriteRequest protobuf message
+func encodeWriteRequest(samples []sample) []byte {
+	var request []byte
+	for _, smp := range samples {
+		names := make([]string, 0, len(smp.labels)+1)
+		names = append(names, "__name__")
+		for name := range smp.labels {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var series []byte
+		for _, name := range names {
+			value := smp.labels[name]
+			if name == "__name__" {
+				value = smp.name
+			}
+			var label []byte
+			label = protowire.AppendTag(label, 1, protowire.BytesType)
+			label = protowire.AppendString(label, name)
+			label = protowire.AppendTag(label, 2, protowire.BytesType)
+			label = protowire.AppendString(label, value)
+
+			series = protowire.AppendTag(series, 1, protowire.BytesType)
+			series = protowire.AppendBytes(series, label)
+		}
+
+		var value []byte
+		value = protowire.AppendTag(value, 1, protowire.Fixed64Type)
+		value = protowire.AppendFixed64(value, math.Float64bits(smp.value))
+		value = protowire.AppendTag(value, 2, protowire.VarintType)
+		value = protowire.AppendVarint(value, uint64(smp.time.UnixMilli()))
+
+		series = protowire.AppendTag(series, 2, protowire.BytesType)
+		series = protowire.AppendBytes(series, value)
+
+		request = protowire.AppendTag(request, 1, protowire.BytesType)
+		request = protowire.AppendBytes(request, series)
+	}
+	return request
+}
@@ -0,0 +1,115 @@
+package udp
+
+import (
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/pstrobl96/prusa_exporter/config"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// decodedSeries is a time series decoded from a WriteRequest
+type decodedSeries struct {
+	labels    map[string]string
+	value     float64
+	timestamp int64
+}
+
+// consumeMessages returns payloads of all length-delimited fields with the given number
+func consumeMessages(t *testing.T, b []byte, field protowire.Number) [][]byte {
+	var messages [][]byte
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			t.Fatalf("invalid tag: %v", protowire.ParseError(n))
+		}
+		b = b[n:]
+		if num == field && typ == protowire.BytesType {
+			v, n := protowire.ConsumeBytes(b)
+			messages = append(messages, v)
+			b = b[n:]
+			continue
+		}
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			t.Fatalf("invalid field: %v", protowire.ParseError(n))
+		}
+		b = b[n:]
+	}
+	return messages
+}
+
+func decodeWriteRequest(t *testing.T, b []byte) []decodedSeries {
+	var result []decodedSeries
+	for _, ts := range consumeMessages(t, b, 1) {
+		series := decodedSeries{labels: map[string]string{}}
+		for _, label := range consumeMessages(t, ts, 1) {
+			parts := consumeMessages(t, label, 1)
+			values := consumeMessages(t, label, 2)
+			series.labels[string(parts[0])] = string(values[0])
+		}
+		for _, smp := range consumeMessages(t, ts, 2) {
+			num, _, n := protowire.ConsumeTag(smp)
+			if num != 1 {
+				t.Fatalf("unexpected sample field %d", num)
+			}
+			bits, m := protowire.ConsumeFixed64(smp[n:])
+			series.value = math.Float64frombits(bits)
+			_, _, k := protowire.ConsumeTag(smp[n+m:])
+			ts, _ := protowire.ConsumeVarint(smp[n+m+k:])
+			series.timestamp = int64(ts)
+		}
+		result = append(result, series)
+	}
+	return result
+}
+
+func TestRemoteWriteSink(t *testing.T) {
+	requests := make(chan []decodedSeries, 2)
+	failures := 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.Header.Get("Content-Encoding") != "snappy" {
+			t.Errorf("unexpected content encoding %q", r.Header.Get("Content-Encoding"))
+		}
+		compressed, _ := io.ReadAll(r.Body)
+		body, err := snappy.Decode(nil, compressed)
+		if err != nil {
+			t.Errorf("snappy decode: %v", err)
+		}
+		requests <- decodeWriteRequest(t, body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sink := newRemoteWriteSink(config.RemoteWrite{URL: server.URL, BatchSize: 2})
+	go sink.run()
+
+	sampled := time.UnixMilli(1700000000123)
+	sink.write(sample{name: "prusa_temp_noz", labels: map[string]string{"mac": "aa", "ip": "10.0.0.1"}, value: 215.5, time: sampled})
+	sink.write(sample{name: "prusa_loadcell_value", labels: map[string]string{"mac": "aa", "ip": "10.0.0.1"}, value: -3, time: sampled.Add(time.Millisecond)})
+
+	select {
+	case series := <-requests:
+		if len(series) != 2 {
+			t.Fatalf("got %d series, want 2", len(series))
+		}
+		if series[0].labels["__name__"] != "prusa_temp_noz" || series[0].labels["mac"] != "aa" || series[0].value != 215.5 || series[0].timestamp != 1700000000123 {
+			t.Errorf("unexpected first series %+v", series[0])
+		}
+		if series[1].labels["__name__"] != "prusa_loadcell_value" || series[1].value != -3 || series[1].timestamp != 1700000000124 {
+			t.Errorf("unexpected second series %+v", series[1])
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no write request received")
+	}
+}
@@ -0,0 +1,209 @@
+package udp
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/pstrobl96/prusa_exporter/config"
+	"github.com/rs/zerolog/log"
+)
+
+// Reasons of rejected messages in prusa_udp_rejected_messages_total
+const (
+	reasonSourceNotAllowed = "source_not_allowed"
+	reasonUnknownPrinter   = "unknown_printer"
+	reasonMacMismatch      = "mac_mismatch"
+)
+
+// maxLoggedSources is number of rejected sources logged as warning, next rejections are logged on debug level
+const maxLoggedSources = 1024
+
+var (
+	rejectedMessages = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "prusa_udp_rejected_messages_total",
+			Help: "Number of syslog messages rejected by the source policy, by reason.",
+		},
+		[]string{"reason"},
+	)
+
+	sources  atomic.Pointer[sourcePolicy]
+	bindings = macBindings{
+		byIP:  make(map[string]string),
+		byMac: make(map[string]string),
+	}
+	loggedSources = struct {
+		mu   sync.Mutex
+		seen map[string]struct{}
+	}{seen: make(map[string]struct{})}
+)
+
+// sourcePolicy decides which senders can push metrics
+type sourcePolicy struct {
+	networks []*net.IPNet
+	printers map[string]struct{} // addresses of configured printers, nil when any address is accepted
+}
+
+// macBindings binds the mac sent by a printer to its address
+type macBindings struct {
+	mu    sync.Mutex
+	byIP  map[string]string
+	byMac map[string]string
+}
+
+// bind binds the mac to the address, previous bindings of both are removed. Caller must hold the mutex.
+func (b *macBindings) bind(ip string, mac string) {
+	delete(b.byMac, b.byIP[ip])
+	delete(b.byIP, b.byMac[mac])
+	b.byIP[ip] = mac
+	b.byMac[mac] = ip
+}
+
+// SetSources sets the source policy from the udp.sources section and addresses of printers in configuration.
+// Printers with mac are bound to it, bindings of addresses which are no longer configured are forgotten.
+func SetSources(cfg config.Config) {
+	policy := &sourcePolicy{}
+	for _, cidr := range cfg.UDP.Sources.AllowedCIDRs {
+		if _, network, err := net.ParseCIDR(cidr); err == nil {
+			policy.networks = append(policy.networks, network)
+		}
+	}
+
+	// addresses are resolved before the lock, checks of incoming messages don't wait for DNS
+	resolved := make(map[string][]string)
+	if cfg.UDP.Sources.KnownPrintersOnly {
+		policy.printers = make(map[string]struct{})
+		for _, printer := range cfg.Printers {
+			resolved[printer.Address] = printerIPs(printer.Address)
+			for _, ip := range resolved[printer.Address] {
+				policy.printers[ip] = struct{}{}
+			}
+		}
+	}
+	sources.Store(policy)
+
+	bindings.mu.Lock()
+	for ip, mac := range bindings.byIP {
+		if _, ok := policy.printers[ip]; !ok {
+			delete(bindings.byIP, ip)
+			delete(bindings.byMac, mac)
+		}
+	}
+	for _, printer := range cfg.Printers {
+		if printer.Mac == "" || policy.printers == nil {
+			continue
+		}
+		for _, ip := range resolved[printer.Address] {
+			bindings.bind(ip, config.NormalizeMac(printer.Mac))
+		}
+	}
+	bindings.mu.Unlock()
+}
+
+// printerIPs returns IP addresses of the printer address, which can be a hostname and contain a port
+func printerIPs(address string) []string {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return []string{ip.String()}
+	}
+
+	ips, err := net.LookupHost(host)
+	if err != nil {
+		log.Error().Msg("Error resolving printer address " + address + " for udp source policy: " + err.Error())
+	}
+	return ips
+}
+
+// checkSource returns an empty reason if the message with mac from ip is accepted by the source policy.
+// A configured printer is bound to the first mac it sends, other macs from its address and its mac from
+// other addresses are rejected then.
+func checkSource(mac string, ip string) string {
+	if reason := checkAddress(ip); reason != "" {
+		return reason
+	}
+	policy := sources.Load()
+	if policy == nil || policy.printers == nil {
+		return ""
+	}
+
+	mac = config.NormalizeMac(mac)
+	bindings.mu.Lock()
+	defer bindings.mu.Unlock()
+	boundMac, ipBound := bindings.byIP[ip]
+	boundIP, macBound := bindings.byMac[mac]
+	if (ipBound && boundMac != mac) || (macBound && boundIP != ip) {
+		return reasonMacMismatch
+	}
+	if !ipBound {
+		bindings.bind(ip, mac)
+		log.Info().Msgf("Printer at %s bound to mac %s", ip, mac)
+	}
+	return ""
+}
+
+// checkAddress returns an empty reason if messages from ip are accepted by the source policy, mac is not checked
+func checkAddress(ip string) string {
+	policy := sources.Load()
+	if policy == nil {
+		return ""
+	}
+
+	if len(policy.networks) > 0 {
+		parsed := net.ParseIP(ip)
+		allowed := false
+		for _, network := range policy.networks {
+			if parsed != nil && network.Contains(parsed) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return reasonSourceNotAllowed
+		}
+	}
+
+	if policy.printers == nil {
+		return ""
+	}
+	if _, ok := policy.printers[ip]; !ok {
+		return reasonUnknownPrinter
+	}
+	return ""
+}
+
+// budgetKey returns key of the budget the series of mac from ip are counted to - the mac when the printer
+// is bound to it, the address otherwise. Mac alone is chosen by the sender, it would get a new budget with every mac.
+func budgetKey(mac string, ip string) string {
+	mac = config.NormalizeMac(mac)
+	bindings.mu.Lock()
+	defer bindings.mu.Unlock()
+	if boundIP, ok := bindings.byMac[mac]; ok && boundIP == ip {
+		return mac
+	}
+	return ip
+}
+
+// rejectMessage counts the rejected message and logs it, every source is logged as warning only once
+func rejectMessage(mac string, ip string, reason string) {
+	rejectedMessages.WithLabelValues(reason).Inc()
+
+	loggedSources.mu.Lock()
+	_, logged := loggedSources.seen[ip+" "+reason]
+	if !logged && len(loggedSources.seen) < maxLoggedSources {
+		loggedSources.seen[ip+" "+reason] = struct{}{}
+	} else {
+		logged = true
+	}
+	loggedSources.mu.Unlock()
+
+	if logged {
+		log.Debug().Msgf("Rejected udp metrics of %s from %s: %s", mac, ip, reason)
+		return
+	}
+	log.Warn().Msgf("Rejected udp metrics of %s from %s: %s", mac, ip, reason)
+}
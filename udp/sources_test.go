@@ -0,0 +1,69 @@
+package udp
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/pstrobl96/prusa_exporter/config"
+)
+
+func TestCheckSource(t *testing.T) {
+	var cfg config.Config
+	cfg.UDP.Sources = config.UDPSources{AllowedCIDRs: []string{"10.0.0.0/24"}, KnownPrintersOnly: true}
+	cfg.Printers = []config.Printers{{Address: "10.0.0.1"}, {Address: "10.0.0.2:8080"}, {Address: "10.0.1.1"}}
+	SetSources(cfg)
+	t.Cleanup(func() { SetSources(config.Config{}) })
+
+	type testCase struct {
+		Mac    string
+		IP     string
+		Reason string
+	}
+	cases := []testCase{
+		{"aa", "10.0.0.1", ""},
+		{"aa", "10.0.0.1", ""},
+		{"bb", "10.0.0.2", ""},
+		{"cc", "10.0.1.1", reasonSourceNotAllowed}, // configured but not in allowed network
+		{"cc", "10.0.0.3", reasonUnknownPrinter},
+		{"cc", "10.0.0.1", reasonMacMismatch}, // address is bound to aa
+		{"aa", "10.0.0.2", reasonMacMismatch}, // aa is bound to 10.0.0.1
+		{"aa", "not an ip", reasonSourceNotAllowed},
+	}
+	for _, tc := range cases {
+		if reason := checkSource(tc.Mac, tc.IP); reason != tc.Reason {
+			t.Errorf("checkSource(%s, %s): got %q, want %q", tc.Mac, tc.IP, reason, tc.Reason)
+		}
+	}
+
+	// bindings of printers removed from configuration are forgotten
+	cfg.Printers = cfg.Printers[1:]
+	cfg.Printers = append(cfg.Printers, config.Printers{Address: "10.0.0.4"})
+	SetSources(cfg)
+	if reason := checkSource("aa", "10.0.0.4"); reason != "" {
+		t.Errorf("expected aa to be bound again, got %q", reason)
+	}
+
+	// printer with mac is bound to it from the start
+	cfg.Printers = append(cfg.Printers, config.Printers{Address: "10.0.0.5", Mac: "10:9C:70:00:00:05"})
+	SetSources(cfg)
+	if reason := checkSource("dd", "10.0.0.5"); reason != reasonMacMismatch {
+		t.Errorf("expected mac mismatch of configured printer, got %q", reason)
+	}
+	if reason := checkSource("10-9c-70-00-00-05", "10.0.0.5"); reason != "" {
+		t.Errorf("expected configured mac to be accepted, got %q", reason)
+	}
+
+	SetSources(config.Config{})
+	if reason := checkSource("cc", "192.168.1.1"); reason != "" {
+		t.Errorf("expected everything to be accepted without policy, got %q", reason)
+	}
+}
+
+func TestRejectMessage(t *testing.T) {
+	before := testutil.ToFloat64(rejectedMessages.WithLabelValues(reasonUnknownPrinter))
+	rejectMessage("aa", "10.0.0.9", reasonUnknownPrinter)
+	rejectMessage("aa", "10.0.0.9", reasonUnknownPrinter)
+	if value := testutil.ToFloat64(rejectedMessages.WithLabelValues(reasonUnknownPrinter)) - before; value != 2 {
+		t.Errorf("rejected messages = %v, expected 2", value)
+	}
+}
@@ -1,35 +1,217 @@
 package udp
 
 import (
+	"crypto/tls"
 	"fmt"
+	"net"
+	"slices"
+	"sync"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/pstrobl96/prusa_exporter/config"
 	"github.com/rs/zerolog/log"
 	"gopkg.in/mcuadros/go-syslog.v2"
+	"gopkg.in/mcuadros/go-syslog.v2/format"
 )
 
-func startSyslogServer(listenUDP string) (syslog.LogPartsChannel, *syslog.Server) {
-	channel := make(syslog.LogPartsChannel)
+// channelSize is number of received messages that may wait for processing
+const channelSize = 1024
+
+// Metrics of syslog listeners, labelled by protocol and address of the listener
+var (
+	listenerUp = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "prusa_udp_listener_up",
+			Help: "Returns 1 if the syslog listener is listening.",
+		},
+		[]string{"listener"},
+	)
+	listenerMessages = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "prusa_udp_listener_messages_total",
+			Help: "Number of syslog messages received by the listener.",
+		},
+		[]string{"listener"},
+	)
+	listenerBytes = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "prusa_udp_listener_received_bytes_total",
+			Help: "Number of bytes of syslog messages received by the listener.",
+		},
+		[]string{"listener"},
+	)
+
+	listenerChannels = struct {
+		mu       sync.Mutex
+		channels []syslog.LogPartsChannel
+	}{}
+)
+
+// listenerName returns name of the listener used as label of its metrics
+func listenerName(listener config.Listener) string {
+	return listenerProtocol(listener) + "://" + listener.Address
+}
+
+func listenerProtocol(listener config.Listener) string {
+	if listener.Protocol == "" {
+		return "udp"
+	}
+	return listener.Protocol
+}
+
+// listenerFormat returns syslog format of the listener. Printer sends metrics of one message on several lines,
+// so messages received over tcp in RFC5424 must be framed by octet counting.
+func listenerFormat(listener config.Listener) format.Format {
+	switch listener.Format {
+	case "rfc3164":
+		return syslog.RFC3164
+	case "automatic":
+		return syslog.Automatic
+	}
+	if listenerProtocol(listener) != "udp" {
+		return syslog.RFC6587
+	}
+	return syslog.RFC5424
+}
+
+func startSyslogServer(listener config.Listener) (syslog.LogPartsChannel, *syslog.Server, error) {
+	channel := make(syslog.LogPartsChannel, channelSize)
 	handler := syslog.NewChannelHandler(channel)
 	server := syslog.NewServer()
-	server.SetFormat(syslog.RFC5424)
+	server.SetFormat(listenerFormat(listener))
 	server.SetHandler(handler)
-	server.ListenUDP(listenUDP)
-	server.Boot()
-	return channel, server
+
+	var err error
+	switch listenerProtocol(listener) {
+	case "tcp":
+		err = server.ListenTCP(listener.Address)
+	case "tls":
+		var cert tls.Certificate
+		cert, err = tls.LoadX509KeyPair(listener.CertFile, listener.KeyFile)
+		if err == nil {
+			err = server.ListenTCPTLS(listener.Address, &tls.Config{Certificates: []tls.Certificate{cert}})
+		}
+	default:
+		err = server.ListenUDP(listener.Address)
+	}
+	if err == nil {
+		err = server.Boot()
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	listenerChannels.mu.Lock()
+	listenerChannels.channels = append(listenerChannels.channels, channel)
+	listenerChannels.mu.Unlock()
+	return channel, server, nil
+}
+
+// listenerGroup is a set of running listeners
+type listenerGroup struct {
+	servers []*syslog.Server
+	conns   []net.PacketConn
+	wg      sync.WaitGroup
+}
+
+// MetricsListener is a function to handle syslog metrics and sent them to processor.
+// Every listener has its own server, all of them feed the same pipeline. Listeners of line format
+// receive plain line protocol without syslog. Without configured listeners
+// metrics are received over udp at listenAddress.
+func MetricsListener(listeners []config.Listener, listenAddress string, prefix string) {
+	startListeners(listeners, listenAddress, prefix).wg.Wait()
 }
 
-// MetricsListener is a function to handle syslog metrics and sent them to processor
-func MetricsListener(listenUDP string, prefix string) {
-	channel, server := startSyslogServer(listenUDP)
+// startListeners starts the listeners, the ones that fail to start are logged and skipped
+func startListeners(listeners []config.Listener, listenAddress string, prefix string) *listenerGroup {
+	if len(listeners) == 0 {
+		listeners = []config.Listener{{Address: listenAddress}}
+	}
+
+	group := &listenerGroup{}
+	for _, listener := range listeners {
+		name := listenerName(listener)
+		if listener.Format == "line" {
+			conn, err := net.ListenPacket("udp", listener.Address)
+			if err != nil {
+				log.Error().Msg("Error starting line protocol listener " + name + ": " + err.Error())
+				listenerUp.WithLabelValues(name).Set(0)
+				continue
+			}
+			log.Info().Msg("Line protocol listener ready at " + name)
+			listenerUp.WithLabelValues(name).Set(1)
+			group.conns = append(group.conns, conn)
+
+			group.wg.Add(1)
+			go func() {
+				defer group.wg.Done()
+				listenLines(conn, listener, prefix)
+				listenerUp.WithLabelValues(name).Set(0)
+			}()
+			continue
+		}
+
+		channel, server, err := startSyslogServer(listener)
+		if err != nil {
+			log.Error().Msg("Error starting syslog listener " + name + ": " + err.Error())
+			listenerUp.WithLabelValues(name).Set(0)
+			continue
+		}
+		log.Info().Msg("Syslog listener ready at " + name)
+		listenerUp.WithLabelValues(name).Set(1)
+		group.servers = append(group.servers, server)
+
+		group.wg.Add(2)
+		go func() {
+			defer group.wg.Done()
+			for logParts := range channel {
+				log.Trace().Msg(fmt.Sprintf("%v", logParts))
 
-	go func(channel syslog.LogPartsChannel) {
-		for logParts := range channel {
-			log.Trace().Msg(fmt.Sprintf("%v", logParts))
+				listenerMessages.WithLabelValues(name).Inc()
+				message, _ := messageOf(logParts)
+				listenerBytes.WithLabelValues(name).Add(float64(len(message)))
+				process(logParts, prefix)
+			}
+		}()
 
-			process(logParts, prefix)
+		go func() {
+			defer group.wg.Done()
+			server.Wait()
+			listenerUp.WithLabelValues(name).Set(0)
+			removeListenerChannel(channel)
+			close(channel) // nothing is sent to the channel once the server is done
+		}()
+	}
+
+	return group
+}
+
+// close stops all listeners of the group and waits until received messages are processed
+func (g *listenerGroup) close() {
+	for _, server := range g.servers {
+		if err := server.Kill(); err != nil {
+			log.Error().Msg("Error stopping syslog listener: " + err.Error())
 		}
-	}(channel)
+	}
+	for _, conn := range g.conns {
+		conn.Close()
+	}
+	g.wg.Wait()
+}
 
-	server.Wait()
+func removeListenerChannel(channel syslog.LogPartsChannel) {
+	listenerChannels.mu.Lock()
+	defer listenerChannels.mu.Unlock()
+	listenerChannels.channels = slices.DeleteFunc(listenerChannels.channels, func(c syslog.LogPartsChannel) bool {
+		return c == channel
+	})
+}
 
+// messageOf returns the message of syslog message, RFC3164 calls it content
+func messageOf(data format.LogParts) (string, bool) {
+	if message, ok := data["message"].(string); ok {
+		return message, true
+	}
+	message, ok := data["content"].(string)
+	return message, ok
 }
@@ -0,0 +1,85 @@
+package udp
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/pstrobl96/prusa_exporter/config"
+)
+
+// freeAddress returns local address with a port that is not used
+func freeAddress(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func TestMetricsListener(t *testing.T) {
+	Init(prometheus.NewRegistry(), false)
+	t.Cleanup(func() { lastPush.Reset() })
+
+	message := "msg=1,tm=100,v=4 listener_temp v=21.5 100\nlistener_fan,fan=1 rpm=300i 110"
+	rfc5424 := func(mac string) string { return "<14>1 2024-01-01T00:00:00Z " + mac + " prusa - - - " + message }
+	octetCounted := func(mac string) string { return fmt.Sprintf("%d %s", len(rfc5424(mac)), rfc5424(mac)) }
+	listeners := []struct {
+		listener config.Listener
+		network  string
+		frame    func(string) string
+	}{
+		{config.Listener{Address: freeAddress(t)}, "udp", rfc5424},
+		{config.Listener{Address: freeAddress(t), Protocol: "tcp"}, "tcp", octetCounted},
+		{config.Listener{Address: freeAddress(t), Protocol: "tcp", Format: "automatic"}, "tcp", octetCounted},
+		{config.Listener{Address: freeAddress(t), Format: "rfc3164"}, "udp", func(mac string) string {
+			return "<14>Jan  1 00:00:00 " + mac + " prusa: " + message
+		}},
+	}
+
+	configured := make([]config.Listener, len(listeners))
+	for i, l := range listeners {
+		configured[i] = l.listener
+	}
+	group := startListeners(configured, "", "prusa_")
+	t.Cleanup(group.close)
+
+	for i, l := range listeners {
+		name := listenerName(l.listener)
+		deadline := time.Now().Add(5 * time.Second)
+		for testutil.ToFloat64(listenerUp.WithLabelValues(name)) != 1 {
+			if time.Now().After(deadline) {
+				t.Fatalf("%s: listener did not start", name)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		conn, err := net.Dial(l.network, l.listener.Address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mac := fmt.Sprintf("listener%d", i)
+		fmt.Fprint(conn, l.frame(mac))
+		conn.Close()
+
+		for testutil.ToFloat64(linesParsed.WithLabelValues(mac)) != 2 {
+			if time.Now().After(deadline) {
+				t.Fatalf("%s: expected 2 parsed lines, got %v", name, testutil.ToFloat64(linesParsed.WithLabelValues(mac)))
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if value := testutil.ToFloat64(listenerMessages.WithLabelValues(name)); value != 1 {
+			t.Errorf("%s: messages = %v, expected 1", name, value)
+		}
+	}
+
+	name := listenerName(config.Listener{Address: listeners[0].listener.Address})
+	if name != "udp://"+listeners[0].listener.Address {
+		t.Errorf("unexpected listener name %s", name)
+	}
+}
@@ -2,44 +2,112 @@ package udp
 
 import (
 	"fmt"
+	"net"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/pstrobl96/prusa_exporter/config"
 	"github.com/rs/zerolog/log"
 	"gopkg.in/mcuadros/go-syslog.v2/format"
 )
 
 type point struct {
 	Measurement string
+	Source      string // measurement name as sent by the printer, without prefix
 	Tags        map[string]string
 	Fields      map[string]interface{} // Use interface{} to handle different field types
+	Offset      int64                  // timestamp of the line, ticks relative to tm of the message header
+	Timed       bool                   // line has a timestamp
+	Ticks       int64                  // printer tick counter, -1 when the line has no timestamp
+	Time        time.Time              // wall clock time of the sample
 }
 
 func process(data format.LogParts, prefix string) {
+	received := time.Now()
 	mac, ip, err := processIdentifiers(data)
 	if err != nil {
 		log.Error().Msg(fmt.Sprintf("Error processing identifiers: %v", err))
+		parseFailures.WithLabelValues(mac, reasonMissingIdentifiers).Inc()
 		return
 	}
-	lastPush.WithLabelValues(mac, strings.Split(ip, ":")[0]).Set(float64(time.Now().Unix())) // Set the last push timestamp
+	host, _, err := net.SplitHostPort(ip)
+	if err != nil {
+		host = ip
+	}
+	if reason := checkSource(mac, host); reason != "" {
+		rejectMessage(mac, host, reason)
+		return
+	}
+	message, _ := messageOf(data)
+	observeMessage(mac, message)
+	printer, configured := lookupPrinter(mac, host)
+	markSeen(mac, strings.Split(ip, ":")[0]) // Set the last push timestamp
 
 	log.Debug().Msg(fmt.Sprintf("Processing data for printer %s", mac))
-	metrics, err := processMessage(data["message"].(string), mac, prefix, ip)
+	metrics, tm, err := processMessage(message, mac, prefix, ip)
 	if err != nil {
 		log.Error().Msg(fmt.Sprintf("Error processing message: %v", err))
+		parseFailures.WithLabelValues(mac, reasonInvalidFormat).Inc()
 		return
 	}
 
+	points := make([]*point, 0, len(metrics))
+	newestTicks := int64(-1)
 	for _, line := range metrics {
 		point, err := parseLineProtocol(line)
 		if err != nil {
 			log.Debug().Msgf("Error parsing line '%s': %v", line, err) // printer sends error with several measurements - tmc_read returns "value_too_long" as well as some raw output data
+			parseFailures.WithLabelValues(mac, failureReason(line, err)).Inc()
 			continue
 		}
+		point.Source = strings.TrimPrefix(point.Measurement, prefix)
+		if point.Timed && tm >= 0 && tm+point.Offset >= 0 {
+			point.Ticks = tm + point.Offset
+		}
+		if acceptPoint(point, line, mac, printer, configured) {
+			newestTicks = max(newestTicks, point.Ticks)
+			points = append(points, point)
+		}
+	}
+
+	exportPoints(points, mac, newestTicks, received)
+}
+
+// acceptPoint counts the parsed line, labels it with the configured printer and returns true
+// if it is accepted by the filter. Lines where the printer reports an error are not accepted.
+func acceptPoint(point *point, line string, mac string, printer config.Printers, configured bool) bool {
+	if _, ok := point.Fields["error"]; ok {
+		log.Debug().Msgf("Printer reported error in line '%s'", line) // e.g. fsensor error="value too long"
+		parseFailures.WithLabelValues(mac, reasonFirmwareError).Inc()
+		return false
+	}
+	linesParsed.WithLabelValues(mac).Inc()
+	if configured {
+		labelPrinter(point, printer)
+	}
+	return filterPoint(point, mac)
+}
+
+// exportPoints sets time of the points from ticks of the printer, or to the time they were received,
+// and exports them to the registry and InfluxDB
+func exportPoints(points []*point, mac string, newestTicks int64, received time.Time) {
+	var clock deviceClock
+	if newestTicks >= 0 {
+		clock = clocks.sync(mac, newestTicks, received)
+	}
+
+	for _, point := range points {
+		point.Time = received
+		if point.Ticks >= 0 {
+			point.Time = clock.time(point.Ticks)
+		}
 
 		registerMetric(*point) // Register the metric with the udp registry
 
+		if influx != nil {
+			influx.write(*point)
+		}
 	}
 }
 
@@ -58,18 +126,21 @@ func processIdentifiers(data format.LogParts) (string, string, error) {
 	return mac, ip, nil
 }
 
-func processMessage(message string, mac string, prefix string, ip string) ([]string, error) {
+// processMessage returns lines of the message labelled with mac and ip, and the tick counter
+// from tm of the message header, or -1 when the header has none
+func processMessage(message string, mac string, prefix string, ip string) ([]string, int64, error) {
 	messageSplit := strings.Split(message, "\n")
 
 	if len(messageSplit) == 0 {
-		return nil, fmt.Errorf("message is empty")
+		return nil, -1, fmt.Errorf("message is empty")
 	}
 
 	firstMessage, err := parseFirstMessage(messageSplit[0])
 
 	if err != nil {
-		return nil, fmt.Errorf("error parsing first message: %v", err)
+		return nil, -1, fmt.Errorf("error parsing first message: %v", err)
 	}
+	tm := headerTicks(messageSplit[0])
 
 	messageSplit = append(messageSplit[1:], firstMessage)
 
@@ -82,7 +153,20 @@ func processMessage(message string, mac string, prefix string, ip string) ([]str
 		}
 		messageSplit[i] = strings.Join(splitted, " ")
 	}
-	return messageSplit, nil
+	return messageSplit, tm, nil
+}
+
+// headerTicks returns tm of the message header, e.g. msg=1,tm=100,v=4, or -1 when it is missing
+func headerTicks(message string) int64 {
+	header, _, _ := strings.Cut(message, " ")
+	for _, part := range strings.Split(header, ",") {
+		if value, ok := strings.CutPrefix(part, "tm="); ok {
+			if tm, err := strconv.ParseInt(value, 10, 64); err == nil && tm >= 0 {
+				return tm
+			}
+		}
+	}
+	return -1
 }
 
 func parseFirstMessage(message string) (string, error) {
@@ -107,6 +191,7 @@ func newPoint() *point {
 	return &point{
 		Tags:   make(map[string]string),
 		Fields: make(map[string]interface{}),
+		Ticks:  -1,
 	}
 }
 
@@ -115,7 +200,7 @@ func parseLineProtocol(line string) (*point, error) {
 
 	parts := splitLine(line)
 	if len(parts) < 2 || len(parts) > 3 {
-		return nil, fmt.Errorf("invalid udp format: %s", line) // this happens when printer sends error message
+		return nil, &parseError{reasonInvalidFormat, fmt.Errorf("invalid udp format: %s", line)} // this happens when printer sends error message
 	}
 
 	measurementTags := parts[0]
@@ -126,7 +211,7 @@ func parseLineProtocol(line string) (*point, error) {
 		tag := measurementTagParts[i]
 		tagParts := strings.SplitN(tag, "=", 2)
 		if len(tagParts) != 2 {
-			return nil, fmt.Errorf("invalid tag format: %s", tag)
+			return nil, &parseError{reasonBadTag, fmt.Errorf("invalid tag format: %s", tag)}
 		}
 		p.Tags[tagParts[0]] = tagParts[1]
 	}
@@ -136,7 +221,7 @@ func parseLineProtocol(line string) (*point, error) {
 	for _, field := range fieldParts {
 		kv := strings.SplitN(field, "=", 2)
 		if len(kv) != 2 {
-			return nil, fmt.Errorf("invalid field format: %s", field)
+			return nil, &parseError{reasonBadField, fmt.Errorf("invalid field format: %s", field)}
 		}
 		key := kv[0]
 		val := kv[1]
@@ -169,6 +254,12 @@ func parseLineProtocol(line string) (*point, error) {
 		p.Fields[key] = val
 	}
 
+	if len(parts) == 3 {
+		if offset, err := strconv.ParseInt(parts[2], 10, 64); err == nil {
+			p.Offset, p.Timed = offset, true
+		}
+	}
+
 	return p, nil
 }
 
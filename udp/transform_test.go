@@ -2,7 +2,13 @@ package udp
 
 import (
 	"slices"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"gopkg.in/mcuadros/go-syslog.v2/format"
 )
 
 func TestSplitLine(t *testing.T) {
@@ -24,3 +30,81 @@ func TestSplitLine(t *testing.T) {
 		}
 	}
 }
+
+func TestProcessPipelineMetrics(t *testing.T) {
+	Init(prometheus.NewRegistry(), false)
+
+	message := "msg=1,tm=100,v=4 temp_noz v=215.5 100\n" +
+		"fan,fan=1 rpm=300i 110\n" +
+		`fsensor error="value too long" 120` + "\n" +
+		"tmc_sg value_too_long\n" +
+		"loadcell,broken v=1 130\n" +
+		"a b c d e\n" +
+		"fan,fan=1 rpm=320i 140"
+	process(format.LogParts{"hostname": "pipeline", "client": "10.0.0.1:5000", "message": message}, "prusa_")
+
+	for _, c := range []struct {
+		counter  prometheus.Collector
+		expected float64
+	}{
+		{messagesReceived.WithLabelValues("pipeline"), 1},
+		{bytesReceived.WithLabelValues("pipeline"), float64(len(message))},
+		{linesParsed.WithLabelValues("pipeline"), 3},
+		{parseFailures.WithLabelValues("pipeline", reasonFirmwareError), 2},
+		{parseFailures.WithLabelValues("pipeline", reasonBadTag), 1},
+		{parseFailures.WithLabelValues("pipeline", reasonInvalidFormat), 1},
+		{familiesCreated.WithLabelValues("pipeline"), 2},
+	} {
+		if value := testutil.ToFloat64(c.counter); value != c.expected {
+			t.Errorf("%s = %v, expected %v", c.counter.(prometheus.Metric).Desc(), value, c.expected)
+		}
+	}
+
+	process(format.LogParts{"client": "10.0.0.1:5000", "message": message}, "prusa_")
+	if value := testutil.ToFloat64(parseFailures.WithLabelValues("", reasonMissingIdentifiers)); value != 1 {
+		t.Errorf("missing identifiers = %v, expected 1", value)
+	}
+}
+
+func TestProcessDeviceTicks(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	Init(registry, true)
+	t.Cleanup(func() { deviceTimestamps = false })
+
+	// lines carry offsets from tm of the header, the first line is sent with the header
+	message := "msg=7,tm=50000,v=4 ticks_a v=1 -200\n" +
+		"ticks_b v=2 0\n" +
+		"ticks_c v=3 300\n" +
+		"ticks_d v=4 -60000"
+	before := time.Now()
+	process(format.LogParts{"hostname": "ticks", "client": "10.0.0.9:5000", "message": message}, "prusa_")
+	after := time.Now()
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	times := map[string]time.Time{}
+	for _, family := range families {
+		for _, measurement := range []string{"ticks_a", "ticks_b", "ticks_c", "ticks_d"} {
+			if strings.Contains(family.GetName(), measurement) {
+				times[measurement] = time.UnixMilli(family.GetMetric()[0].GetTimestampMs())
+			}
+		}
+	}
+
+	// the newest line is anchored to the time the message was received
+	newest := times["ticks_c"]
+	if newest.Before(before.Truncate(time.Millisecond)) || newest.After(after) {
+		t.Errorf("ticks_c: got %v, want between %v and %v", newest, before, after)
+	}
+	for measurement, offset := range map[string]time.Duration{"ticks_a": -500 * time.Millisecond, "ticks_b": -300 * time.Millisecond} {
+		if got := times[measurement]; !got.Equal(newest.Add(offset)) {
+			t.Errorf("%s: got %v, want %v", measurement, got, newest.Add(offset))
+		}
+	}
+	// line before tick 0 gets the time the message was received
+	if got := times["ticks_d"]; got.Before(before.Truncate(time.Millisecond)) || got.After(after) {
+		t.Errorf("ticks_d: got %v, want between %v and %v", got, before, after)
+	}
+}